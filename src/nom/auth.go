@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Auth keeps credentials of hosts and adds them to requests (basic or bearer authorization).
+// Credentials are loaded from netrc file or from "auth" options of global entity
+// (values may refer to environment variables):
+//
+//	global "auth" {
+//	  auth "intranet.example.com" = "basic ${INTRANET_USER}:${INTRANET_PASSWORD}"
+//	  auth "api.example.com" = "bearer ${API_TOKEN}"
+//	}
+type Auth struct {
+	hosts map[string]*Credentials
+}
+
+type Credentials struct {
+	Login    string
+	Password string
+	Token    string // bearer token (login and password aren't used then)
+}
+
+func NewAuth() *Auth {
+	return &Auth{
+		hosts: make(map[string]*Credentials),
+	}
+}
+
+// LoadNetrc reads credentials of hosts from netrc file ("default" entry is ignored,
+// so credentials are never sent to unknown hosts; "macdef" macros are skipped)
+func (a *Auth) LoadNetrc(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	var credentials *Credentials // nil - entry of "default" machine
+	keyword := ""                // keyword which waits for its value (values may be on the next line)
+	macro := false               // inside of macro definition (its lines aren't credentials)
+
+	for scanner.Scan() {
+		if macro {
+			macro = strings.TrimSpace(scanner.Text()) != "" // macro ends with blank line
+			continue
+		}
+
+		for _, token := range strings.Fields(scanner.Text()) {
+			if keyword == "" {
+				switch token {
+				case "machine", "login", "password", "account", "macdef":
+					keyword = token
+				case "default":
+					credentials = nil
+				}
+				continue
+			}
+
+			switch keyword {
+			case "machine":
+				credentials = &Credentials{}
+				a.hosts[token] = credentials
+			case "login":
+				if credentials != nil {
+					credentials.Login = token
+				}
+			case "password":
+				if credentials != nil {
+					credentials.Password = token
+				}
+			case "macdef":
+				macro = true // body of macro starts on the next line
+			}
+			keyword = ""
+
+			if macro {
+				break
+			}
+		}
+	}
+
+	if keyword != "" {
+		return fmt.Errorf("netrc: missed value of \"%s\"", keyword)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	logrus.WithField("file", file).WithField("hosts", len(a.hosts)).Info("auth: netrc loaded")
+	return nil
+}
+
+// Parse adds credentials of host from value "basic <login>:<password>" or "bearer <token>"
+func (a *Auth) Parse(host string, value string) error {
+	value, err := expandVariables(value)
+	if err != nil {
+		return fmt.Errorf("auth \"%s\": %s", host, err)
+	}
+
+	parts := strings.SplitN(value, " ", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("auth \"%s\": value must be \"basic <login>:<password>\" or \"bearer <token>\"", host)
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "basic":
+		login := strings.SplitN(parts[1], ":", 2)
+		if len(login) != 2 {
+			return fmt.Errorf("auth \"%s\": basic credentials must be \"<login>:<password>\"", host)
+		}
+		a.hosts[host] = &Credentials{Login: login[0], Password: login[1]}
+	case "bearer":
+		a.hosts[host] = &Credentials{Token: parts[1]}
+	default:
+		return fmt.Errorf("auth \"%s\": unknown scheme \"%s\" (must be \"basic\" or \"bearer\")", host, parts[0])
+	}
+
+	return nil
+}
+
+// Apply sets Authorization header of request if there are credentials for its host
+// (host with port or just host name)
+func (a *Auth) Apply(req *http.Request) {
+	credentials, found := a.hosts[req.URL.Host]
+	if !found {
+		credentials, found = a.hosts[req.URL.Hostname()]
+	}
+	if !found {
+		return
+	}
+
+	if credentials.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+credentials.Token)
+	} else {
+		req.SetBasicAuth(credentials.Login, credentials.Password)
+	}
+}
+
+// NewTLSConfig builds tls config with custom root CAs (added to system ones),
+// client certificates (pairs of cert and key files) and optionally disabled verification
+func NewTLSConfig(caFile string, certs [][2]string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+
+	if insecure {
+		logrus.Warn("auth: verification of server certificates is disabled")
+	}
+
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in \"%s\"", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	for _, pair := range certs {
+		cert, err := tls.LoadX509KeyPair(pair[0], pair[1])
+		if err != nil {
+			return nil, fmt.Errorf("client certificate \"%s\": %s", pair[0], err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	return config, nil
+}
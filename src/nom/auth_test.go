@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthLoadNetrc(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "netrc")
+	err := ioutil.WriteFile(file, []byte(`
+machine intranet.example.com
+  login bob
+  password "secret"
+machine localhost:8080 login alice password pa55
+default login anonymous password guest
+macdef init
+machine evil.example.com login mallory password stolen
+login eve password intercepted
+
+machine api.example.com login carol account x password s3
+macdef upload
+put file.zip
+machine localhost:8080 login mallory
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := NewAuth()
+	if err := auth.LoadNetrc(file); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url           string
+		authorization string // empty - no credentials
+	}{
+		{"http://intranet.example.com/", "Basic Ym9iOiJzZWNyZXQi"}, // netrc has no quoting
+		{"http://localhost:8080/", "Basic YWxpY2U6cGE1NQ=="},
+		{"http://localhost:9090/", ""},
+		{"http://api.example.com/", "Basic Y2Fyb2w6czM="},
+		{"http://unknown.example.com/", ""}, // default entry is ignored
+		{"http://evil.example.com/", ""},    // macro body isn't entry
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		auth.Apply(req)
+
+		if value := req.Header.Get("Authorization"); value != test.authorization {
+			t.Errorf("%s: Authorization = %q, want %q", test.url, value, test.authorization)
+		}
+	}
+}
+
+func TestAuthLoadNetrcErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "netrc")
+	if err := ioutil.WriteFile(file, []byte("machine example.com login"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewAuth().LoadNetrc(file); err == nil {
+		t.Error("netrc without value of login is accepted")
+	}
+
+	if err := NewAuth().LoadNetrc(file + ".missed"); err == nil {
+		t.Error("missed netrc file is accepted")
+	}
+}
+
+func TestAuthParse(t *testing.T) {
+	os.Setenv("NOM_TEST_TOKEN", "t0ken")
+	defer os.Unsetenv("NOM_TEST_TOKEN")
+
+	tests := []struct {
+		value         string
+		authorization string
+		err           bool
+	}{
+		{"basic bob:secret", "Basic Ym9iOnNlY3JldA==", false},
+		{"Basic bob:pass:with:colons", "Basic Ym9iOnBhc3M6d2l0aDpjb2xvbnM=", false},
+		{"bearer ${NOM_TEST_TOKEN}", "Bearer t0ken", false},
+		{"bearer ${NOM_TEST_MISSED}", "", true},
+		{"basic bob", "", true},
+		{"digest bob:secret", "", true},
+		{"secret", "", true},
+	}
+
+	for _, test := range tests {
+		auth := NewAuth()
+
+		err := auth.Parse("example.com", test.value)
+		if (err != nil) != test.err {
+			t.Errorf("%q: error = %v, want error %v", test.value, err, test.err)
+			continue
+		}
+
+		req := httptest.NewRequest("GET", "https://example.com:443/", nil)
+		auth.Apply(req)
+
+		if value := req.Header.Get("Authorization"); value != test.authorization {
+			t.Errorf("%q: Authorization = %q, want %q", test.value, value, test.authorization)
+		}
+	}
+}
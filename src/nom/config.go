@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/alecthomas/participle"
 )
 
@@ -9,9 +12,17 @@ type Grammar struct {
 }
 
 type ConfigEntity struct {
-	Type   string   `@Ident`
-	Name   string   `@String`
-	Routes []*Route `["{" { @@ } "}"]`
+	Type    string    `@Ident`
+	Name    string    `@String`
+	Options []*Option `["{" { @@ }` // options must precede routes
+	Routes  []*Route  `{ @@ } "}"]`
+}
+
+// Option is setting of entity, e.g. `header "User-Agent" = "nom"`
+type Option struct {
+	Key   string `@Ident`
+	Name  string `[ @String ]`
+	Value string `"=" @String`
 }
 
 type Route struct {
@@ -20,6 +31,87 @@ type Route struct {
 	Name     string `@String`
 }
 
+// Entity finds entity by its type and name
+func (g *Grammar) Entity(kind string, name string) *ConfigEntity {
+	for _, entity := range g.Entities {
+		if entity.Type == kind && entity.Name == name {
+			return entity
+		}
+	}
+	return nil
+}
+
+// Settings returns options with key from "global" entities and then from page entity
+// (so page options may override global ones)
+func (g *Grammar) Settings(page string, key string) []*Option {
+	options := make([]*Option, 0)
+
+	for _, entity := range g.Entities {
+		if entity.Type == "global" {
+			options = append(options, entity.Find(key)...)
+		}
+	}
+
+	if entity := g.Entity("page", page); entity != nil {
+		options = append(options, entity.Find(key)...)
+	}
+
+	return options
+}
+
+// Setting returns the last value of option with key and name (see Settings)
+func (g *Grammar) Setting(page string, key string, name string) (string, bool) {
+	value, found := "", false
+
+	for _, option := range g.Settings(page, key) {
+		if option.Name == name {
+			value, found = option.Value, true
+		}
+	}
+
+	return value, found
+}
+
+// Find returns all options with key
+func (e *ConfigEntity) Find(key string) []*Option {
+	options := make([]*Option, 0)
+
+	for _, option := range e.Options {
+		if option.Key == key {
+			options = append(options, option)
+		}
+	}
+
+	return options
+}
+
+// String formats entity back to config syntax
+func (e *ConfigEntity) String() string {
+	lines := make([]string, 0, len(e.Options)+len(e.Routes)+2)
+
+	lines = append(lines, fmt.Sprintf("%s %q {", e.Type, e.Name))
+	for _, option := range e.Options {
+		lines = append(lines, "  "+option.String())
+	}
+	for _, route := range e.Routes {
+		lines = append(lines, "  "+route.String())
+	}
+	lines = append(lines, "}")
+
+	return strings.Join(lines, "\n")
+}
+
+func (o *Option) String() string {
+	if o.Name != "" {
+		return fmt.Sprintf("%s %q = %q", o.Key, o.Name, o.Value)
+	}
+	return fmt.Sprintf("%s = %q", o.Key, o.Value)
+}
+
+func (r *Route) String() string {
+	return fmt.Sprintf("%q -> %s %q", r.Selector, r.Type, r.Name)
+}
+
 func parseConfig(text string) (*Grammar, error) {
 	parser, err := participle.Build(&Grammar{}, nil)
 	if err != nil {
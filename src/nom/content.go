@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var ErrUnexpectedContent = errors.New("unexpected type of content")
+
+// preferred extensions for common media types (mime package returns them in alphabetical order, e.g. ".jfif" for jpeg)
+var mediaExtensions = map[string]string{
+	"text/html":                ".html",
+	"text/plain":               ".txt",
+	"text/csv":                 ".csv",
+	"application/pdf":          ".pdf",
+	"application/zip":          ".zip",
+	"application/x-gzip":       ".gz",
+	"application/gzip":         ".gz",
+	"application/json":         ".json",
+	"application/xml":          ".xml",
+	"image/jpeg":               ".jpg",
+	"image/png":                ".png",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"audio/mpeg":               ".mp3",
+	"video/mp4":                ".mp4",
+	"application/octet-stream": ".bin",
+}
+
+// sniffContent returns media type of response by Content-Type header and beginning of body
+// and checks that it's html document (which may be parsed)
+func sniffContent(header string, head []byte) (string, bool) {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	binary := !strings.HasPrefix(sniffed, "text/")
+
+	declared, _, err := mime.ParseMediaType(header)
+	if err != nil || declared == "application/octet-stream" {
+		return sniffed, sniffed == "text/html"
+	}
+
+	if binary && (strings.HasPrefix(declared, "text/") || strings.HasSuffix(declared, "+xml")) {
+		return sniffed, false // e.g. pdf served as text/html
+	}
+
+	return declared, declared == "text/html" || declared == "application/xhtml+xml"
+}
+
+// checkContent applies content rules of config to page with content of media type:
+//
+//	global "content" {
+//	  content "binary" = "file"  // binary content of page is saved as file (or "reject")
+//	  content "html" = "reject"  // html instead of downloaded file is error (or "file")
+//	}
+//
+// Page may be switched to file mode.
+func checkContent(config *Grammar, page *Page, mediaType string, html bool) error {
+	setting := func(name string, fallback string) string {
+		if config == nil {
+			return fallback
+		}
+		if value, found := config.Setting(page.Name, "content", name); found {
+			return value
+		}
+		return fallback
+	}
+
+	binary := !html && !isTextual(mediaType)
+
+	switch {
+	case !page.IsFile && binary:
+		if setting("binary", "file") == "reject" {
+			return fmt.Errorf("%w: %s instead of html page", ErrUnexpectedContent, mediaType)
+		}
+		page.IsFile = true
+
+	case page.IsFile && html:
+		if setting("html", "reject") == "reject" {
+			return fmt.Errorf("%w: html page instead of file", ErrUnexpectedContent)
+		}
+	}
+
+	return nil
+}
+
+// isTextual checks that content of media type is text (e.g. json of api), only other content is binary
+func isTextual(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	for _, suffix := range []string{"xml", "json", "javascript", "ecmascript", "yaml", "x-www-form-urlencoded"} {
+		if strings.HasSuffix(mediaType, suffix) {
+			return true // e.g. application/json, application/ld+json, application/rss+xml
+		}
+	}
+
+	return false
+}
+
+// fileExtension returns extension for files of media type (empty - unknown type)
+func fileExtension(mediaType string) string {
+	if ext, found := mediaExtensions[mediaType]; found {
+		return ext
+	}
+
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ""
+}
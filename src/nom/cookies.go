@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CookieJar is cookie jar of crawl which can be saved to file and loaded back between runs
+type CookieJar struct {
+	*cookiejar.Jar
+
+	File string // empty - cookies are kept only in memory
+
+	mutex   sync.Mutex
+	cookies map[string][]*http.Cookie // all cookies set by servers (url -> cookies)
+}
+
+func NewCookieJar(file string) (*CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cookieJar := &CookieJar{
+		Jar:  jar,
+		File: file,
+
+		cookies: make(map[string][]*http.Cookie),
+	}
+
+	if file == "" {
+		return cookieJar, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cookieJar, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &cookieJar.cookies)
+	if err != nil {
+		return nil, err
+	}
+
+	for rawUrl, cookies := range cookieJar.cookies {
+		cookieUrl, err := url.Parse(rawUrl)
+		if err != nil {
+			return nil, err
+		}
+		jar.SetCookies(cookieUrl, cookies)
+	}
+
+	logrus.WithField("file", file).WithField("urls", len(cookieJar.cookies)).Info("cookies: loaded")
+	return cookieJar, nil
+}
+
+func (j *CookieJar) SetCookies(cookieUrl *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(cookieUrl, cookies)
+
+	if j.File == "" {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	key := (&url.URL{Scheme: cookieUrl.Scheme, Host: cookieUrl.Host, Path: cookieUrl.Path}).String()
+
+	// replace cookies with the same names
+	saved := j.cookies[key]
+	for _, cookie := range cookies {
+		replaced := false
+		for i, old := range saved {
+			if old.Name == cookie.Name && old.Path == cookie.Path && old.Domain == cookie.Domain {
+				saved[i], replaced = cookie, true
+			}
+		}
+
+		if !replaced {
+			saved = append(saved, cookie)
+		}
+	}
+	j.cookies[key] = saved
+
+	if err := j.save(); err != nil {
+		logrus.WithField("file", j.File).WithError(err).Error("cookies: can't save")
+	}
+}
+
+func (j *CookieJar) save() error {
+	data, err := json.Marshal(j.cookies)
+	if err != nil {
+		return err
+	}
+
+	// write to temporary file first, so interrupted crawl doesn't corrupt saved cookies
+	err = ioutil.WriteFile(j.File+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(j.File+".tmp", j.File)
+}
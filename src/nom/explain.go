@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const explainStyle = `<style>
+.nom-match { outline: 2px solid #e4572e !important; position: relative; }
+.nom-match::before {
+	content: attr(data-nom);
+	position: absolute; top: -1.4em; left: 0; z-index: 100000;
+	background: #e4572e; color: #fff; font: 11px/1.3em monospace; padding: 0 3px; white-space: nowrap;
+}
+body { margin-right: 32% !important; }
+#nom-sidebar {
+	position: fixed; top: 0; right: 0; bottom: 0; width: 30%; overflow: auto; z-index: 100001;
+	background: #fafafa; border-left: 1px solid #ccc; color: #222; font: 12px/1.4em monospace; padding: 8px;
+}
+#nom-sidebar ul { padding-left: 1.2em; margin: 0; }
+#nom-sidebar .nom-field { color: #e4572e; }
+</style>`
+
+// Explain parses page like Try does, but writes html copy of page where every node
+// matched by route is outlined and labeled with "entity/route" name
+// and sidebar with extracted values is added.
+func (t *Tryout) Explain(w io.Writer, key string, entity string, route *Route) error {
+	page, config, doc, err := t.prepare(key, entity, route)
+	if err != nil {
+		return err
+	}
+
+	matches := &explainMatches{labels: make(map[*html.Node][]string)}
+	t.parser.trace = matches.collect
+	defer func() { t.parser.trace = nil }()
+
+	tree, _ := t.parser.parseRecursive(page, doc.Selection, config)
+	matches.mark() // nodes are changed only after parsing, so routes match the same way as in crawl
+
+	head := doc.Find("head")
+	if page.FinalUrl != "" && doc.Find("base[href]").Length() == 0 {
+		head.PrependHtml(fmt.Sprintf(`<base href="%s">`, html.EscapeString(page.FinalUrl))) // keep relative styles and images working
+	}
+	head.PrependHtml(`<meta charset="utf-8">`) // document is always rendered as utf-8
+	head.AppendHtml(explainStyle)
+
+	sidebar := &strings.Builder{}
+	fmt.Fprintf(sidebar, `<div id="nom-sidebar"><b>%s "%s"</b> %s`, config.Type, html.EscapeString(config.Name), html.EscapeString(page.Url))
+	explainBlock(sidebar, tree)
+	sidebar.WriteString(`</div>`)
+	doc.Find("body").AppendHtml(sidebar.String())
+
+	content, err := doc.Html()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+// explainMatches collects nodes matched by routes with their "entity/route" labels
+type explainMatches struct {
+	nodes  []*html.Node // in order of matching
+	labels map[*html.Node][]string
+}
+
+func (m *explainMatches) collect(config *ConfigEntity, route *Route, sel *goquery.Selection) {
+	label := config.Name + "/" + route.Name
+
+	for _, node := range sel.Nodes {
+		if _, found := m.labels[node]; !found {
+			m.nodes = append(m.nodes, node)
+		}
+		m.labels[node] = append(m.labels[node], label) // node may be matched by several routes
+	}
+}
+
+// mark outlines and labels collected nodes
+func (m *explainMatches) mark() {
+	for _, node := range m.nodes {
+		sel := goquery.NewDocumentFromNode(node).Selection
+		sel.AddClass("nom-match")
+		sel.SetAttr("data-nom", strings.Join(m.labels[node], ", "))
+	}
+}
+
+func explainBlock(w io.Writer, block *Block) {
+	names := make([]string, 0, len(block.Fields))
+	for name := range block.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	io.WriteString(w, "<ul>")
+	for _, name := range names {
+		fmt.Fprintf(w, `<li><span class="nom-field">%s</span>`, html.EscapeString(name))
+
+		io.WriteString(w, "<ul>")
+		for _, value := range block.Fields[name] {
+			switch value := value.(type) {
+			case *Block:
+				io.WriteString(w, "<li>block")
+				explainBlock(w, value)
+				io.WriteString(w, "</li>")
+			default:
+				fmt.Fprintf(w, "<li>%s</li>", html.EscapeString(fmt.Sprintf("%q", value)))
+			}
+		}
+		io.WriteString(w, "</ul></li>")
+	}
+	io.WriteString(w, "</ul>")
+}
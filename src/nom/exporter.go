@@ -2,17 +2,24 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/sirupsen/logrus"
 )
 
 type Exporter struct {
+	Link  bool          // hard link files from blob storage instead of copying them
+	Blobs *StorageBlobs // storage of downloaded files (Page.Blob is relative to it)
+
 	storage   Storage
 	tokenizer *regexp.Regexp
 	steps     []*ExportStep
@@ -21,6 +28,7 @@ type Exporter struct {
 type ExportStep struct {
 	Name   string // page name
 	Field  string // field on this page
+	Meta   string // optional provenance of field instead of its value ("selector", "path" or "url")
 	Filler string // .. or simply part of path
 }
 
@@ -61,15 +69,26 @@ func (e *Exporter) parseRule(rule string) {
 			token = strings.Trim(token, "{}")
 			arr := strings.Split(token, ":")
 
-			if len(arr) < 2 {
-				logrus.Fatalf("Error parsing rule: token must be in format \"page_name:field\", but \"%s\" found", token)
+			if len(arr) < 2 || len(arr) > 3 {
+				logrus.Fatalf("Error parsing rule: token must be in format \"page_name:field\" or \"page_name:field:meta\", but \"%s\" found", token)
 			}
 
-			e.steps = append(e.steps, &ExportStep{
+			step := &ExportStep{
 				Name:   arr[0],
 				Field:  arr[1],
 				Filler: "",
-			})
+			}
+
+			if len(arr) == 3 {
+				switch arr[2] {
+				case "selector", "path", "url":
+					step.Meta = arr[2]
+				default:
+					logrus.Fatalf("Error parsing rule: unknown meta \"%s\" (must be \"selector\", \"path\" or \"url\")", arr[2])
+				}
+			}
+
+			e.steps = append(e.steps, step)
 		}
 	}
 
@@ -101,16 +120,16 @@ func (e *Exporter) exportRecursive(path string, page *Page, extractChilds bool,
 
 	// At token-step we may want to extract all child pages for that token...
 	if extractChilds {
-		urls, err := e.extractField(page, step.Name)
+		keys, err := e.childKeys(page, step.Name)
 		if err != nil {
 			logrus.WithError(err).Errorf("exporter: error extracting urls for child pages \"%s\" from \"%s\"", step.Name, page.Name)
 			return
 		}
 
-		for _, url := range urls {
-			childPage := e.storage.Get(url)
+		for _, key := range keys {
+			childPage := e.storage.Get(key)
 			if childPage == nil {
-				logrus.WithField("url", url).Error("exporter: can't load page")
+				logrus.WithField("url", key).Error("exporter: can't load page")
 				return
 			}
 
@@ -127,7 +146,7 @@ func (e *Exporter) exportRecursive(path string, page *Page, extractChilds bool,
 		return
 	}
 
-	value, err := e.preparePathValue(page, step.Field)
+	value, err := e.preparePathValue(page, step.Field, step.Meta)
 	if err != nil {
 		logrus.WithError(err).Errorf("exporter: error extracting field \"%s\"", step.Field)
 		return
@@ -136,7 +155,16 @@ func (e *Exporter) exportRecursive(path string, page *Page, extractChilds bool,
 	e.exportRecursive(path+value, page, true, steps[1:])
 }
 
-func (e *Exporter) preparePathValue(page *Page, field string) (string, error) {
+func (e *Exporter) preparePathValue(page *Page, field string, meta string) (string, error) {
+	if meta != "" {
+		values, err := e.extractSources(page, field, meta)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.Replace(strings.Join(values, " "), "/", "-", -1), nil
+	}
+
 	// special field names
 	switch field {
 	case "ext":
@@ -155,6 +183,37 @@ func (e *Exporter) preparePathValue(page *Page, field string) (string, error) {
 		// TODO: sanitize value (allow only [a-zA-Z'". ])
 		return page.FileName, nil
 
+	case "status":
+		return strconv.Itoa(page.Status), nil
+
+	case "type":
+		mediaType := page.MediaType
+		if mediaType == "" { // pages fetched by older versions
+			var err error
+			mediaType, _, err = mime.ParseMediaType(page.ContentType)
+			if err != nil {
+				return "", fmt.Errorf("wrong content type of \"%s\": %s", page.Name, err)
+			}
+		}
+
+		return strings.Replace(mediaType, "/", "-", -1), nil
+
+	case "fetched":
+		return page.FetchedAt.UTC().Format("20060102-150405"), nil
+
+	case "latency":
+		return strconv.FormatInt(page.Latency.Nanoseconds()/int64(time.Millisecond), 10), nil
+
+	case "redirects":
+		return strconv.Itoa(len(page.Redirects)), nil
+
+	case "sha256":
+		if !page.IsFile {
+			return "", fmt.Errorf("can't find checksum for \"%s\", page is not downloadable file", page.Name)
+		}
+
+		return page.Sha256, nil
+
 	}
 
 	values, err := e.extractField(page, field)
@@ -185,6 +244,38 @@ func (e *Exporter) extractField(page *Page, field string) ([]string, error) {
 	return res, nil
 }
 
+// childKeys returns storage keys of child pages found by field: urls of pages
+// or keys of form submissions (see Block.Keys)
+func (e *Exporter) childKeys(page *Page, field string) ([]string, error) {
+	if keys, found := page.Tree.Keys[field]; found {
+		return keys, nil
+	}
+
+	return e.extractField(page, field)
+}
+
+// extractSources returns provenance of field values (see Parser.Provenance)
+func (e *Exporter) extractSources(page *Page, field string, meta string) ([]string, error) {
+	sources, found := page.Tree.Sources[field]
+	if !found {
+		return nil, fmt.Errorf("missed provenance of \"%s\" field for page \"%s\" (was it parsed with --provenance?)", field, page.Name)
+	}
+
+	res := make([]string, 0, len(sources))
+	for _, source := range sources {
+		switch meta {
+		case "selector":
+			res = append(res, source.Selector)
+		case "path":
+			res = append(res, source.Path)
+		case "url":
+			res = append(res, source.Url)
+		}
+	}
+
+	return res, nil
+}
+
 func (e *Exporter) dumpPage(path string, page *Page) error {
 	if !page.IsFile {
 		return fmt.Errorf("page is not downloaded file and can't be exported (TODO)")
@@ -193,5 +284,39 @@ func (e *Exporter) dumpPage(path string, page *Page) error {
 	dir := filepath.Dir(path)
 	os.MkdirAll(dir, 0755)
 
+	if page.Blob != "" {
+		return e.dumpBlob(path, e.Blobs.Path(page.Blob))
+	}
+
 	return ioutil.WriteFile(path, page.Body, 0644)
 }
+
+// dumpBlob copies or links downloaded file from blob storage
+func (e *Exporter) dumpBlob(path string, blob string) error {
+	if e.Link {
+		os.Remove(path)
+		if err := os.Link(blob, path); err == nil {
+			return nil
+		}
+		// e.g. export to another device, falling back to copying
+	}
+
+	src, err := os.Open(blob)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FetcherPool fetches pages of different hosts simultaneously with several workers,
+// every host has own queue, concurrency limit and delay between requests.
+type FetcherPool struct {
+	*FetcherSimple // fetching itself, channels and Queue/Delivery/Errors methods
+
+	Workers int                  // max count of simultaneous requests (for all hosts)
+	Default *HostRule            // rule for hosts without own rule
+	Hosts   map[string]*HostRule // rules for specific hosts
+
+	workers chan struct{}
+	hosts   map[string]*poolHost
+}
+
+// HostRule limits load of single host
+type HostRule struct {
+	Concurrency int           // max count of simultaneous requests to host
+	Delay       time.Duration // min interval between requests to host (the fastest rate of adaptive limiter)
+}
+
+type poolHost struct {
+	name  string
+	rule  *HostRule
+	queue chan *Page
+	slots chan struct{}
+}
+
+func NewFetcherPool(pageUrl string, workers int, rule *HostRule) (*FetcherPool, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("wrong count of workers %d (must be at least 1)", workers)
+	}
+
+	if rule.Concurrency < 1 {
+		return nil, fmt.Errorf("wrong host concurrency %d (must be at least 1)", rule.Concurrency)
+	}
+
+	simple, err := NewFetcherSimple(pageUrl, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FetcherPool{
+		FetcherSimple: simple,
+
+		Workers: workers,
+		Default: rule,
+		Hosts:   make(map[string]*HostRule),
+
+		workers: make(chan struct{}, workers),
+		hosts:   make(map[string]*poolHost),
+	}, nil
+}
+
+// ParseHostRule parses rule in format "host=concurrency,delay" (e.g. "example.com=2,500ms")
+func ParseHostRule(text string) (string, *HostRule, error) {
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("host rule must be in format \"host=concurrency,delay\", but \"%s\" found", text)
+	}
+
+	params := strings.Split(parts[1], ",")
+	if len(params) != 2 {
+		return "", nil, fmt.Errorf("host rule must be in format \"host=concurrency,delay\", but \"%s\" found", text)
+	}
+
+	concurrency, err := strconv.Atoi(params[0])
+	if err != nil || concurrency < 1 {
+		return "", nil, fmt.Errorf("wrong concurrency \"%s\" in host rule", params[0])
+	}
+
+	delay, err := time.ParseDuration(params[1])
+	if err != nil {
+		return "", nil, err
+	}
+
+	return parts[0], &HostRule{Concurrency: concurrency, Delay: delay}, nil
+}
+
+func (f *FetcherPool) Start(ctx context.Context) {
+	f.inflight.Add(1) // before goroutine start, so Wait() doesn't miss it
+	go f.run(ctx)
+}
+
+func (f *FetcherPool) run(ctx context.Context) {
+	defer f.inflight.Done()
+	logrus.WithField("workers", f.Workers).Info("fetcher: starting pool")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case page := <-f.queue:
+			name := f.host(page)
+
+			host, found := f.hosts[name]
+			if !found {
+				host = f.newHost(name)
+				f.hosts[name] = host
+
+				f.inflight.Add(1)
+				go f.serve(ctx, host)
+			}
+
+			host.queue <- page
+		}
+	}
+}
+
+func (f *FetcherPool) newHost(name string) *poolHost {
+	rule, found := f.Hosts[name]
+	if !found {
+		rule = f.Default
+	}
+
+	logrus.WithField("host", name).WithField("concurrency", rule.Concurrency).WithField("delay", rule.Delay).Info("fetcher: new host")
+
+	return &poolHost{
+		name:  name,
+		rule:  rule,
+		queue: make(chan *Page, 100000),
+		slots: make(chan struct{}, rule.Concurrency),
+	}
+}
+
+// serve starts fetching of host pages keeping host rule and global workers limit
+func (f *FetcherPool) serve(ctx context.Context, host *poolHost) {
+	defer f.inflight.Done()
+
+	for {
+		var page *Page
+
+		select {
+		case <-ctx.Done():
+			return
+		case page = <-host.queue:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case host.slots <- struct{}{}:
+		}
+
+		if f.Limiter.Wait(ctx, host.name, f.politeDelay(host.name, host.rule.Delay)) != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case f.workers <- struct{}{}:
+		}
+
+		f.inflight.Add(1) // before goroutine start, so Wait() doesn't miss it
+		go func(page *Page) {
+			defer f.inflight.Done()
+
+			f.fetch(ctx, page)
+
+			<-f.workers
+			<-host.slots
+		}(page)
+	}
+}
@@ -2,12 +2,21 @@ package main
 
 import (
 	//"github.com/davecgh/go-spew/spew"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/c2h5oh/datasize"
@@ -17,17 +26,40 @@ import (
 type Fetcher interface {
 	Errors() <-chan *Page
 	Delivery() <-chan *Page
-	Queue(page *Page)
-	Start()
+	Queue(ctx context.Context, page *Page)
+	Start(ctx context.Context) // launches fetching which is stopped (with requests in flight) on cancellation of context
+	Wait()                     // waits for fetching loop and requests in flight after cancellation
 }
 
+const defaultUserAgent = "nom"
+
+var ErrChecksumMismatch = errors.New("checksum of downloaded file doesn't match published one")
+
+// pageKey is key of fetched page in request context
+type pageKey struct{}
+
 type FetcherSimple struct {
-	Base  *url.URL
-	Delay int
+	Base    *url.URL // scheme and host of start url (for relative urls without referrer only)
+	Delay   int
+	Config  *Grammar      // global and page settings (headers, ...), may be nil
+	Client  *http.Client  // client for all requests (with cookie jar of crawl)
+	Robots  *Robots       // nil - robots.txt is not respected
+	Retry   *RetryPolicy  // nil - failed pages are not retried
+	Limiter *RateLimiter  // adaptive rate of requests for every host
+	Proxies *ProxyPool    // nil - proxies from environment (HTTP_PROXY, ...) are used
+	Blobs   *StorageBlobs // nil - downloaded files are kept in memory (page.Body)
+	Auth    *Auth         // nil - requests are sent without credentials
+
+	Redirects *RedirectPolicy // limits of followed redirects
+	Timeouts  Timeouts        // limits of request stages (may be overridden for page entities)
+
+	Sessions []*Session // login sessions for hosts which require them
 
 	delivery chan *Page
 	errors   chan *Page
 	queue    chan *Page
+
+	inflight sync.WaitGroup
 }
 
 func NewFetcherSimple(pageUrl string, delay int) (*FetcherSimple, error) {
@@ -41,72 +73,414 @@ func NewFetcherSimple(pageUrl string, delay int) (*FetcherSimple, error) {
 		Host:   parsedUrl.Host,
 	}
 
-	return &FetcherSimple{
-		Base:  baseUrl,
-		Delay: delay,
+	jar, err := NewCookieJar("")
+	if err != nil {
+		return nil, err
+	}
+
+	fetcher := &FetcherSimple{
+		Base:    baseUrl,
+		Delay:   delay,
+		Limiter: NewRateLimiter(),
+
+		Redirects: NewRedirectPolicy(10, false),
 
 		delivery: make(chan *Page),
 		errors:   make(chan *Page),
 		queue:    make(chan *Page),
-	}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = fetcher.proxy
+	transport.DialContext = fetcher.dial
+
+	fetcher.Client = &http.Client{Jar: jar, Transport: transport, CheckRedirect: fetcher.checkRedirect}
+	fetcher.Robots = NewRobots(defaultUserAgent, fetcher.Client)
+
+	return fetcher, nil
 }
 
-// NOTE: Start this as goroutine
-func (f *FetcherSimple) Start() {
+func (f *FetcherSimple) Start(ctx context.Context) {
+	f.inflight.Add(1) // before goroutine start, so Wait() doesn't miss it
+	go f.run(ctx)
+}
+
+func (f *FetcherSimple) run(ctx context.Context) {
+	defer f.inflight.Done()
 	logrus.Info("fetcher: starting")
 
-	// TODO: not optimal sleeping, we can interrupt sleep if it was longer than f.Delay
-	for page := range f.queue {
-		f.fetch(page) // process one page at time than go to sleep...
-		time.Sleep(time.Duration(f.Delay) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case page := <-f.queue:
+			host := f.host(page)
+
+			if f.Limiter.Wait(ctx, host, f.politeDelay(host, time.Duration(f.Delay)*time.Second)) != nil {
+				return
+			}
+			f.fetch(ctx, page) // process one page at time
+		}
 	}
 }
 
-func (f *FetcherSimple) fetch(page *Page) {
+// host returns host of page (empty for wrong urls, such pages are dropped by fetch())
+func (f *FetcherSimple) host(page *Page) string {
+	fullUrl, err := f.resolveFullUrl(page)
+	if err != nil {
+		return ""
+	}
+
+	pageUrl, err := url.Parse(fullUrl)
+	if err != nil {
+		return ""
+	}
+
+	return pageUrl.Host
+}
+
+// politeDelay returns delay before next request to host (Crawl-delay from robots.txt if it's longer)
+func (f *FetcherSimple) politeDelay(host string, delay time.Duration) time.Duration {
+	if f.Robots == nil {
+		return delay
+	}
+
+	if crawlDelay := f.Robots.CrawlDelay(host); crawlDelay > delay {
+		return crawlDelay
+	}
+
+	return delay
+}
+
+func (f *FetcherSimple) fetch(ctx context.Context, page *Page) {
+	f.inflight.Add(1)
+	defer f.inflight.Done()
+
+	page.Attempts++
+
 	fullUrl, err := f.resolveFullUrl(page)
 	if err != nil {
 		logrus.WithField("url", page.Url).WithError(err).Error("fetcher: wrong url")
-		f.dropPage(page, err)
+		f.dropPage(ctx, page, err)
 		return
 	}
 
 	page.FullUrl = fullUrl
 
-	res, err := http.Get(page.FullUrl)
+	pageUrl, err := url.Parse(fullUrl)
 	if err != nil {
-		f.dropPage(page, err)
+		f.dropPage(ctx, page, err)
 		return
 	}
-	defer res.Body.Close()
 
-	body, err := ioutil.ReadAll(res.Body)
+	if f.Robots != nil {
+		if err := f.Robots.Check(ctx, pageUrl); err != nil {
+			f.dropPage(ctx, page, err)
+			return
+		}
+	}
+
+	req, err := f.request(page)
 	if err != nil {
-		f.dropPage(page, err)
+		f.dropPage(ctx, page, networkError(err))
 		return
 	}
-	page.Body = body
 
-	if res.StatusCode < 200 || res.StatusCode > 302 {
-		f.dropPage(page, fmt.Errorf("Server returns error code %s", res.StatusCode))
-		return
+	timeouts := f.timeouts(page)
+	reqCtx, cancel, headerTimer := withTimeouts(ctx, timeouts)
+	defer cancel()
+
+	choice := &proxyChoice{}
+	reqCtx = context.WithValue(reqCtx, proxyChoiceKey{}, choice)
+	req = req.WithContext(context.WithValue(reqCtx, pageKey{}, page))
+
+	page.Redirects = nil // filled by checkRedirect
+	started := time.Now()
+
+	res, err := f.Client.Do(req)
+
+	if !headersReceived(headerTimer) && ctx.Err() == nil {
+		if err == nil {
+			res.Body.Close() // timer fired right after receiving of headers, body can't be read anyway
+		}
+		err = ErrHeaderTimeout
 	}
 
-	logrus.WithField("url", page.Url).Info("fetcher: success fetch")
+	if choice.url != nil {
+		page.Proxy = redactUrl(choice.url)
+		f.Proxies.Report(pageUrl.Host, choice.url, err == nil && res.StatusCode != http.StatusProxyAuthRequired)
+	}
 
+	if err != nil {
+		fetchErr := networkError(err)
+		if choice.url != nil {
+			fetchErr.Temporary = true // retry through another proxy
+		}
+
+		f.dropPage(ctx, page, fetchErr)
+		return
+	}
+	defer res.Body.Close()
+
+	page.Status = res.StatusCode
+	page.Headers = res.Header
+	page.Latency = time.Since(started)
 	page.FinalUrl = res.Request.URL.String()
 
+	if res.StatusCode == http.StatusProxyAuthRequired && choice.url != nil {
+		f.dropPage(ctx, page, &FetchError{Status: res.StatusCode, Temporary: true}) // retry through another proxy
+		return
+	}
+
+	f.Limiter.Observe(pageUrl.Host, res, page.Latency)
+
+	if err := f.Redirects.CheckFinalUrl(f.Config, page); err != nil {
+		f.dropPage(ctx, page, &FetchError{Err: err})
+		return
+	}
+
+	if res.StatusCode == http.StatusNotModified && page.cached != nil {
+		logrus.WithField("url", page.Url).Info("fetcher: page not modified, using stored copy")
+
+		f.reuseCached(page)
+		f.deliver(ctx, page)
+		return
+	}
+
+	page.ContentType = res.Header.Get("Content-Type")
+
+	idle := withIdleTimeout(res.Body, timeouts.Idle, cancel) // stalled body doesn't block fetcher
+	defer idle.Stop()
+
+	// sniff beginning of body when header is missed or lies
+	body := bufio.NewReaderSize(idle, 512)
+	head, _ := body.Peek(512)
+
+	html := false
+	if res.StatusCode == http.StatusPartialContent && page.IsFile && f.Blobs != nil {
+		page.MediaType = f.resumedMediaType(page) // body starts in the middle of file
+	} else {
+		page.MediaType, html = sniffContent(page.ContentType, head)
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		wasFile := page.IsFile
+
+		if err := checkContent(f.Config, page, page.MediaType, html); err != nil {
+			f.dropPage(ctx, page, &FetchError{Err: err})
+			return
+		}
+
+		if page.IsFile != wasFile {
+			logrus.WithField("url", page.Url).WithField("type", page.MediaType).Info("fetcher: binary content, saving page as file")
+		}
+	}
+
+	if page.IsFile && f.Blobs != nil {
+		err := f.saveBlob(page, res, body)
+		if err != nil {
+			f.dropPage(ctx, page, timeoutError(reqCtx, err))
+			return
+		}
+	} else {
+		body, err := ioutil.ReadAll(body)
+		if err != nil {
+			f.dropPage(ctx, page, timeoutError(reqCtx, networkError(err)))
+			return
+		}
+		if res.ContentLength >= 0 && int64(len(body)) != res.ContentLength {
+			f.dropPage(ctx, page, &FetchError{Temporary: true, Err: ErrTruncated})
+			return
+		}
+
+		page.Body = body
+		page.Size = int64(len(body))
+
+		if page.IsFile {
+			sum := sha256.Sum256(body)
+			page.Sha256 = hex.EncodeToString(sum[:])
+		} else {
+			_, page.Encoding = detectEncoding(page)
+		}
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		f.dropPage(ctx, page, statusError(res.StatusCode))
+		return
+	}
+
+	// only complete successful downloads are compared (error pages are dropped above)
+	if page.Checksum != "" && page.Sha256 != page.Checksum {
+		if page.Blob != "" {
+			os.Remove(f.Blobs.Path(page.Blob))
+			page.Blob = ""
+		}
+
+		logrus.WithField("url", page.Url).WithField("expected", page.Checksum).WithField("sha256", page.Sha256).Warn("fetcher: checksum mismatch")
+		f.dropPage(ctx, page, &FetchError{Temporary: true, Err: ErrChecksumMismatch})
+		return
+	}
+
+	if session := f.session(pageUrl); session != nil && session.IsLoggedOut(page) {
+		logrus.WithField("url", page.Url).WithField("session", session.Name).Warn("fetcher: page is fetched without session, logging in again")
+
+		if err := session.Relogin(ctx, f, started); err != nil {
+			logrus.WithField("session", session.Name).WithError(err).Error("fetcher: can't login")
+		}
+
+		f.dropPage(ctx, page, &FetchError{Temporary: true, Err: ErrLoggedOut}) // retry with new session
+		return
+	}
+
+	logrus.WithField("url", page.Url).WithField("status", page.Status).WithField("latency", page.Latency).WithField("redirects", len(page.Redirects)).WithField("proxy", page.Proxy).WithField("encoding", page.Encoding).Info("fetcher: success fetch")
+
+	page.ETag = res.Header.Get("ETag")
+	page.LastModified = res.Header.Get("Last-Modified")
+	page.FetchedAt = time.Now()
+
 	if page.IsFile {
 		err := f.parseFileName(res, page)
 		if err != nil {
-			f.dropPage(page, err)
+			f.dropPage(ctx, page, err)
 			return
 		}
 
-		size := datasize.ByteSize(len(page.Body))
+		size := datasize.ByteSize(page.Size)
 		logrus.WithField("file_name", page.FileName).WithField("final_url", page.FinalUrl).WithField("size", size.HumanReadable()).Info("fetcher: file info")
 	}
 
-	f.delivery <- page
+	f.deliver(ctx, page)
+}
+
+// deliver sends fetched page to delivery channel (unless fetching is canceled)
+func (f *FetcherSimple) deliver(ctx context.Context, page *Page) {
+	select {
+	case f.delivery <- page:
+	case <-ctx.Done():
+	}
+}
+
+// request prepares request for page with Referer and headers from config
+func (f *FetcherSimple) request(page *Page) (*http.Request, error) {
+	method := page.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	req, err := http.NewRequest(method, page.FullUrl, strings.NewReader(page.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if page.Payload != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if page.ReferrerUrl != "" {
+		req.Header.Set("Referer", page.ReferrerUrl)
+	}
+
+	f.setHeaders(req, page.Name)
+
+	if page.IsFile && f.Blobs != nil {
+		if part := f.Blobs.Partial(page.Key()); part.Size > 0 {
+			logrus.WithField("url", page.Url).WithField("offset", part.Size).Info("fetcher: resuming download")
+
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", part.Size))
+			req.Header.Set("If-Range", part.Validator) // server sends whole file if it was changed
+		}
+	}
+
+	if page.cached != nil {
+		if page.cached.ETag != "" {
+			req.Header.Set("If-None-Match", page.cached.ETag)
+		}
+		if page.cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", page.cached.LastModified)
+		}
+	}
+
+	return req, nil
+}
+
+// reuseCached fills page with content of its stored copy (after 304 Not Modified)
+func (f *FetcherSimple) reuseCached(page *Page) {
+	cached := page.cached
+
+	page.FinalUrl = cached.FinalUrl
+	page.Status = cached.Status // response of stored page rather than 304 of revalidation
+	page.Headers = cached.Headers
+	if page.Status == 0 {
+		page.Status = http.StatusOK // stored by older version (only successful pages are stored)
+	}
+	page.IsFile = cached.IsFile
+	page.FileName = cached.FileName
+	page.Blob = cached.Blob
+	page.Size = cached.Size
+	page.Sha256 = cached.Sha256
+	page.Body = cached.Body
+	page.ContentType = cached.ContentType
+	page.MediaType = cached.MediaType
+	page.Encoding = cached.Encoding
+	page.Tree = cached.Tree
+	page.ETag = cached.ETag
+	page.LastModified = cached.LastModified
+	page.FetchedAt = time.Now()
+	page.cached = nil
+}
+
+// setHeaders sets User-Agent, credentials of host and headers from config (global and of page with name)
+func (f *FetcherSimple) setHeaders(req *http.Request, name string) {
+	req.Header.Set("User-Agent", defaultUserAgent)
+
+	if f.Auth != nil {
+		f.Auth.Apply(req) // Authorization header of config takes precedence
+	}
+
+	if f.Config == nil {
+		return
+	}
+
+	for _, option := range f.Config.Settings(name, "header") {
+		if option.Name != "" {
+			req.Header.Set(option.Name, option.Value)
+		}
+	}
+}
+
+// checkRedirect applies redirect policy to redirects of fetched page
+func (f *FetcherSimple) checkRedirect(req *http.Request, via []*http.Request) error {
+	page, _ := req.Context().Value(pageKey{}).(*Page)
+	return f.Redirects.Check(f.Config, page, req, via)
+}
+
+// proxy chooses proxy for request (from pool of proxies or from environment)
+// and saves it to proxyChoice of request context
+func (f *FetcherSimple) proxy(req *http.Request) (*url.URL, error) {
+	if f.Proxies == nil {
+		return http.ProxyFromEnvironment(req)
+	}
+
+	proxyUrl := f.Proxies.Pick(req.URL.Host)
+	if proxyUrl == nil {
+		return nil, ErrNoProxies
+	}
+
+	if choice, ok := req.Context().Value(proxyChoiceKey{}).(*proxyChoice); ok {
+		choice.url = proxyUrl
+	}
+
+	return proxyUrl, nil
+}
+
+// session returns login session for host of url (nil - host doesn't need login)
+func (f *FetcherSimple) session(pageUrl *url.URL) *Session {
+	for _, session := range f.Sessions {
+		if session.Covers(pageUrl) {
+			return session
+		}
+	}
+	return nil
 }
 
 func (f *FetcherSimple) resolveFullUrl(page *Page) (string, error) {
@@ -115,21 +489,102 @@ func (f *FetcherSimple) resolveFullUrl(page *Page) (string, error) {
 		return "", err
 	}
 
+	// links found by parser are already absolute (<base/> tag is taken into account there),
+	// so pages of another hosts are never resolved against base
+	if pUrl.IsAbs() {
+		return pUrl.String(), nil
+	}
+
 	// resolve page.Url based on page.ReferrerUrl
-	// TODO: take into account <base/> tag on page
 	if page.ReferrerUrl != "" {
 		rUrl, err := url.Parse(page.ReferrerUrl)
 		if err != nil {
 			return "", err
 		}
 
-		pUrl = rUrl.ResolveReference(pUrl) // update page url
+		return rUrl.ResolveReference(pUrl).String(), nil
 	}
 
-	// finally resolve resolved page.Url (make it absolute url)
+	// finally resolve relative page.Url without referrer (e.g. start url)
 	return f.Base.ResolveReference(pUrl).String(), nil
 }
 
+// saveBlob streams body of downloaded file to blob storage
+func (f *FetcherSimple) saveBlob(page *Page, res *http.Response, body io.Reader) error {
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		f.Blobs.Discard(page.Key())
+		return &FetchError{Status: res.StatusCode, Temporary: true} // download again from the beginning
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return statusError(res.StatusCode) // don't download error pages
+	}
+
+	offset := int64(0)
+	if res.StatusCode == http.StatusPartialContent {
+		var err error
+		offset, err = parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil {
+			f.Blobs.Discard(page.Key())
+			return &FetchError{Temporary: true, Err: err}
+		}
+	}
+
+	if res.ContentLength >= 0 && f.Blobs.TooLarge(offset+res.ContentLength) {
+		f.Blobs.Discard(page.Key())
+		return &FetchError{Err: ErrFileTooLarge}
+	}
+
+	// keep partial download only if it may be resumed
+	part := BlobPart{Size: offset, MediaType: page.MediaType}
+	if res.StatusCode == http.StatusPartialContent || res.Header.Get("Accept-Ranges") == "bytes" {
+		part.Validator = rangeValidator(res)
+	}
+
+	blob, size, sum, err := f.Blobs.Save(page.Key(), body, res.ContentLength, part)
+	switch {
+	case err == ErrFileTooLarge:
+		return &FetchError{Err: err}
+	case err == ErrPartialChanged || err == ErrTruncated:
+		return &FetchError{Temporary: true, Err: err}
+	case err != nil:
+		return networkError(err)
+	}
+
+	page.Blob = blob
+	page.Size = size
+	page.Sha256 = sum
+
+	return nil
+}
+
+// resumedMediaType returns media type of resumed download recorded at its start
+func (f *FetcherSimple) resumedMediaType(page *Page) string {
+	if part := f.Blobs.Partial(page.Key()); part.MediaType != "" {
+		return part.MediaType
+	}
+	return "application/octet-stream"
+}
+
+// rangeValidator returns value for If-Range header of next requests
+// (strong ETag or Last-Modified date, empty - response can't be resumed safely)
+func rangeValidator(res *http.Response) string {
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return res.Header.Get("Last-Modified")
+}
+
+// parseContentRange returns first byte of partial content, e.g. 100 for "bytes 100-199/200"
+func parseContentRange(header string) (int64, error) {
+	var first, last int64
+	_, err := fmt.Sscanf(header, "bytes %d-%d/", &first, &last)
+	if err != nil {
+		return 0, fmt.Errorf("wrong Content-Range header \"%s\"", header)
+	}
+	return first, nil
+}
+
 func (f *FetcherSimple) parseFileName(resp *http.Response, page *Page) error {
 	if header := resp.Header.Get("Content-Disposition"); header != "" {
 		_, params, err := mime.ParseMediaType(header)
@@ -146,13 +601,37 @@ func (f *FetcherSimple) parseFileName(resp *http.Response, page *Page) error {
 		page.FileName = path.Base(resp.Request.URL.Path)
 	}
 
+	if page.FileName == "/" || page.FileName == "." {
+		page.FileName = "index"
+	}
+
+	if path.Ext(page.FileName) == "" {
+		page.FileName += fileExtension(page.MediaType)
+	}
+
 	return nil
 }
 
-func (f *FetcherSimple) dropPage(page *Page, err error) {
-	logrus.WithField("full_url", page.FullUrl).WithError(err).Error("fetcher: error fetching")
-
+func (f *FetcherSimple) dropPage(ctx context.Context, page *Page, err error) {
 	page.err = err
+
+	if ctx.Err() != nil {
+		logrus.WithField("full_url", page.FullUrl).Info("fetcher: fetching canceled")
+		return
+	}
+
+	log := logrus.WithField("full_url", page.FullUrl).WithField("status", page.Status).WithField("attempts", page.Attempts).WithError(err)
+
+	if f.Retry != nil && f.Retry.Retryable(page) {
+		delay := f.Retry.Backoff(page.Attempts)
+		log.WithField("delay", delay).Warn("fetcher: temporary error, retrying later")
+
+		time.AfterFunc(delay, func() { f.Queue(ctx, page) })
+		return
+	}
+
+	log.Error("fetcher: error fetching")
+
 	select {
 	case f.errors <- page:
 		return
@@ -169,6 +648,13 @@ func (f *FetcherSimple) Errors() <-chan *Page {
 	return f.errors
 }
 
-func (f *FetcherSimple) Queue(page *Page) {
-	f.queue <- page
+func (f *FetcherSimple) Queue(ctx context.Context, page *Page) {
+	select {
+	case f.queue <- page:
+	case <-ctx.Done():
+	}
+}
+
+func (f *FetcherSimple) Wait() {
+	f.inflight.Wait()
 }
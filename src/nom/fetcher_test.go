@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header string
+		first  int64
+		err    bool
+	}{
+		{"bytes 100-199/200", 100, false},
+		{"bytes 0-0/1", 0, false},
+		{"bytes 6-10/*", 6, false},
+		{"bytes */200", 0, true},
+		{"items 1-2/3", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		first, err := parseContentRange(test.header)
+		if (err != nil) != test.err || first != test.first {
+			t.Errorf("parseContentRange(%q) = %d, %v, want %d (error %v)", test.header, first, err, test.first, test.err)
+		}
+	}
+}
+
+// newBlobFetcher returns fetcher with blob storage in temporary dir and interrupted download "hello " of page
+func newBlobFetcher(t *testing.T) (*FetcherSimple, *Page) {
+	f, err := NewFetcherSimple("http://example.com/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Blobs = &StorageBlobs{Base: t.TempDir()}
+
+	page := &Page{Url: "http://example.com/file.bin", FullUrl: "http://example.com/file.bin", IsFile: true}
+
+	body := io.MultiReader(strings.NewReader("hello "), iotest.ErrReader(errors.New("connection reset")))
+	_, _, _, err = f.Blobs.Save(page.Key(), body, 11, BlobPart{Validator: `"v1"`, MediaType: "application/pdf"})
+	if err == nil {
+		t.Fatal("interrupted download is saved as complete")
+	}
+
+	if part := f.Blobs.Partial(page.Key()); part.Size != 6 || part.Validator != `"v1"` {
+		t.Fatalf("partial download = %+v, want 6 bytes with validator", part)
+	}
+
+	return f, page
+}
+
+func response(status int, body string, headers map[string]string) *http.Response {
+	res := &http.Response{
+		StatusCode:    status,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	for name, value := range headers {
+		res.Header.Set(name, value)
+	}
+	return res
+}
+
+func TestSaveBlobResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		res       *http.Response
+		temporary bool   // expected error
+		status    int    // ... and its status
+		content   string // expected blob (empty - error)
+		partial   int64  // expected size of partial download after response
+	}{
+		{
+			name:    "resumed",
+			res:     response(206, "world", map[string]string{"Content-Range": "bytes 6-10/11", "ETag": `"v1"`}),
+			content: "hello world",
+		},
+		{
+			name:    "whole file again",
+			res:     response(200, "HELLO WORLD", map[string]string{"Accept-Ranges": "bytes", "ETag": `"v2"`}),
+			content: "HELLO WORLD",
+		},
+		{
+			name:      "range not satisfiable",
+			res:       response(416, "", nil),
+			temporary: true,
+			status:    416,
+		},
+		{
+			name:      "wrong range",
+			res:       response(206, "world", map[string]string{"Content-Range": "bytes */11"}),
+			temporary: true,
+		},
+		{
+			name:    "not found",
+			res:     response(404, "not found", nil),
+			status:  404,
+			partial: 6, // kept until the file is fetched again
+		},
+	}
+
+	for _, test := range tests {
+		f, page := newBlobFetcher(t)
+
+		err := f.saveBlob(page, test.res, test.res.Body)
+
+		if test.content == "" {
+			fetchErr, ok := err.(*FetchError)
+			if !ok || fetchErr.Temporary != test.temporary || fetchErr.Status != test.status {
+				t.Errorf("%s: error = %#v, want temporary %v with status %d", test.name, err, test.temporary, test.status)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+
+			content, err := ioutil.ReadFile(f.Blobs.Path(page.Blob))
+			if err != nil || string(content) != test.content {
+				t.Errorf("%s: blob = %q (%v), want %q", test.name, content, err, test.content)
+			}
+
+			sum := sha256.Sum256([]byte(test.content))
+			if page.Sha256 != hex.EncodeToString(sum[:]) || page.Size != int64(len(test.content)) {
+				t.Errorf("%s: size %d and sha256 %s don't match content", test.name, page.Size, page.Sha256)
+			}
+		}
+
+		if part := f.Blobs.Partial(page.Key()); part.Size != test.partial {
+			t.Errorf("%s: partial download has %d bytes, want %d", test.name, part.Size, test.partial)
+		}
+	}
+}
+
+func TestRequestRange(t *testing.T) {
+	f, page := newBlobFetcher(t)
+
+	req, err := f.request(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value := req.Header.Get("Range"); value != "bytes=6-" {
+		t.Errorf("Range = %q, want \"bytes=6-\"", value)
+	}
+	if value := req.Header.Get("If-Range"); value != `"v1"` {
+		t.Errorf("If-Range = %q, want validator of partial download", value)
+	}
+
+	f.Blobs.Discard(page.Key())
+
+	req, err = f.request(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := req.Header.Get("Range"); value != "" {
+		t.Errorf("Range = %q for discarded download", value)
+	}
+}
+
+func TestResumedMediaType(t *testing.T) {
+	f, page := newBlobFetcher(t)
+
+	// resumed body starts in the middle of file, so Content-Type of its response isn't used
+	if mediaType := f.resumedMediaType(page); mediaType != "application/pdf" {
+		t.Errorf("media type = %q, want type recorded at start of download", mediaType)
+	}
+}
+
+func TestFetchProxyAuthRequired(t *testing.T) {
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer rejecting.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>" + r.URL.String() + "</html>"))
+	}))
+	defer working.Close()
+
+	f, err := NewFetcherSimple("http://example.com/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Robots = nil
+	f.Retry = &RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	f.Proxies, err = NewProxyPool([]string{rejecting.URL, working.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f.Start(ctx)
+	go f.Queue(ctx, &Page{Url: "http://example.com/item"})
+
+	select {
+	case page := <-f.Delivery():
+		if page.Attempts != 2 || page.Proxy != working.URL {
+			t.Errorf("page is fetched through %s with %d attempts, want second attempt through %s", page.Proxy, page.Attempts, working.URL)
+		}
+	case page := <-f.Errors():
+		t.Errorf("page is dropped with error %v, want retry through another proxy", page.err)
+	case <-ctx.Done():
+		t.Error("page isn't fetched")
+	}
+
+	cancel()
+	f.Wait()
+}
+
+func TestFetchChecksum(t *testing.T) {
+	const content = "hello world"
+	sum := sha256.Sum256([]byte(content))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missed.bin":
+			http.NotFound(w, r)
+		case "/broken.bin":
+			w.Write([]byte("hello w0rld"))
+		default:
+			w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path   string
+		status int   // expected status of failed download
+		err    error // expected error (nil - file is delivered)
+	}{
+		{"/file.bin", 0, nil},
+		{"/broken.bin", 0, ErrChecksumMismatch},
+		{"/missed.bin", http.StatusNotFound, nil}, // error page isn't compared with checksum
+	}
+
+	for _, test := range tests {
+		f, err := NewFetcherSimple(server.URL, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Robots = nil
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		f.Start(ctx)
+		go f.Queue(ctx, &Page{Url: test.path, IsFile: true, Checksum: hex.EncodeToString(sum[:])})
+
+		select {
+		case <-f.Delivery():
+			if test.err != nil || test.status != 0 {
+				t.Errorf("%s: file is delivered, want error", test.path)
+			}
+		case page := <-f.Errors():
+			fetchErr, ok := page.err.(*FetchError)
+			if !ok || fetchErr.Status != test.status || fetchErr.Err != test.err {
+				t.Errorf("%s: error = %v, want status %d (%v)", test.path, page.err, test.status, test.err)
+			}
+		case <-ctx.Done():
+			t.Errorf("%s: file isn't fetched", test.path)
+		}
+
+		cancel()
+		f.Wait()
+	}
+}
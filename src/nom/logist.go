@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
+	"sync"
+
 	"github.com/sirupsen/logrus"
 )
 
 type Logist struct {
+	Refresh bool // revalidate stored pages with server instead of delivering them as is
+
 	fetcher Fetcher
 	storage Storage
 
 	delivery chan *Page
+
+	mutex   sync.Mutex
+	closed  bool           // stored pages aren't delivered anymore (shutdown)
+	pending sync.WaitGroup // delivered pages which aren't stored yet
+
+	stop    chan struct{} // closed by Wait() when fetcher doesn't deliver pages anymore
+	stopped chan struct{} // closed when all fetched pages are taken from fetcher
 }
 
 func NewLogist(fetcher Fetcher, storage Storage) *Logist {
@@ -17,23 +29,36 @@ func NewLogist(fetcher Fetcher, storage Storage) *Logist {
 		storage: storage,
 
 		delivery: make(chan *Page),
+
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 }
 
-func (l *Logist) Fetch(page *Page) {
+func (l *Logist) Fetch(ctx context.Context, page *Page) {
 	log := logrus.WithField("url", page.Url)
-	savedPage := l.storage.Get(page.Url)
-	if savedPage != nil {
+	savedPage := l.storage.Get(page.Key())
+	if savedPage != nil && !l.Refresh {
 		log.Info("logist: from storage")
-		l.delivery <- savedPage
+		if l.acquire() {
+			l.delivery <- savedPage
+		}
 		return
 	}
 
+	if savedPage != nil {
+		log.Info("logist: revalidating stored page")
+		page.cached = savedPage
+	}
+
 	log.Info("logist: to fetcher")
-	l.fetcher.Queue(page)
+	l.fetcher.Queue(ctx, page)
 }
 
+// Store saves delivered page after parsing
 func (l *Logist) Store(page *Page) {
+	defer l.pending.Done()
+
 	if page.IsChanged() {
 		logrus.WithField("url", page.Url).Info("logist: page changed, storing...")
 
@@ -52,17 +77,53 @@ func (l *Logist) Errors() <-chan *Page {
 	return l.fetcher.Errors()
 }
 
-func (l *Logist) Start() {
+func (l *Logist) Start(ctx context.Context) {
 	logrus.Info("logist: starting")
 
 	go l.processFetcher()
-	go l.fetcher.Start()
+	l.fetcher.Start(ctx)
+}
+
+// Wait stops delivery of pages and waits until delivered pages are stored
+// (call it after fetcher.Wait(), so all fetched pages are delivered)
+func (l *Logist) Wait() {
+	l.mutex.Lock()
+	l.closed = true
+	l.mutex.Unlock()
+
+	close(l.stop)
+	<-l.stopped // page taken from fetcher right before shutdown is pending too
+
+	l.pending.Wait()
 }
 
+// acquire marks stored page as pending until it's stored again (false - logist is closed, page mustn't be delivered)
+func (l *Logist) acquire() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return false
+	}
+
+	l.pending.Add(1)
+	return true
+}
+
+// processFetcher delivers fetched pages until Wait() is called (every fetched page is saved)
 func (l *Logist) processFetcher() {
-	for page := range l.fetcher.Delivery() {
-		logrus.WithField("url", page.Url).Info("logist: saving to storage")
-		l.storage.Put(page)
-		l.delivery <- page
+	defer close(l.stopped)
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case page := <-l.fetcher.Delivery():
+			l.pending.Add(1) // Wait() doesn't wait for pending pages until this loop is stopped
+
+			logrus.WithField("url", page.Url).Info("logist: saving to storage")
+			l.storage.Put(page)
+			l.delivery <- page
+		}
 	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFetcher delivers pages which are sent to its channel by test
+type fakeFetcher struct {
+	delivery chan *Page
+	errors   chan *Page
+}
+
+func (f *fakeFetcher) Errors() <-chan *Page                  { return f.errors }
+func (f *fakeFetcher) Delivery() <-chan *Page                { return f.delivery }
+func (f *fakeFetcher) Queue(ctx context.Context, page *Page) {}
+func (f *fakeFetcher) Start(ctx context.Context)             {}
+func (f *fakeFetcher) Wait()                                 {}
+
+type memoryStorage struct {
+	mutex sync.Mutex
+	pages map[string]*Page
+	puts  int
+}
+
+func (s *memoryStorage) Get(key string) *Page {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.pages[key]
+}
+
+func (s *memoryStorage) Put(page *Page) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pages[page.Key()] = page
+	s.puts++
+}
+
+func (s *memoryStorage) Iterate() <-chan *Page {
+	return nil
+}
+
+func TestLogistWaitStoresFetchedPages(t *testing.T) {
+	fetcher := &fakeFetcher{delivery: make(chan *Page), errors: make(chan *Page)}
+	storage := &memoryStorage{pages: make(map[string]*Page)}
+
+	logist := NewLogist(fetcher, storage)
+	logist.Start(context.Background())
+
+	// parser stores delivered pages after (slow) parsing
+	go func() {
+		for page := range logist.Delivery() {
+			time.Sleep(10 * time.Millisecond)
+			page.Body = []byte("parsed")
+			logist.Store(page)
+		}
+	}()
+
+	page := &Page{Url: "http://example.com/"}
+	fetcher.delivery <- page // fetcher is done right after handing off its last page
+
+	logist.Wait()
+
+	if storage.puts != 2 {
+		t.Errorf("page is saved %d times, want saving before and after parsing", storage.puts)
+	}
+
+	// pages of storage aren't delivered after shutdown
+	done := make(chan bool)
+	go func() {
+		logist.Fetch(context.Background(), &Page{Url: "http://example.com/"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("stored page is delivered after shutdown")
+	}
+}
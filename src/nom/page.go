@@ -3,7 +3,9 @@ package main
 import (
 	"crypto/md5"
 	"fmt"
+	"net/http"
 	"reflect"
+	"time"
 
 	"github.com/vmihailenco/msgpack"
 )
@@ -15,13 +17,34 @@ type Page struct {
 	ReferrerUrl string // full url of referrer page (for relative page.Url resolving)
 	FullUrl     string // start url from which page was really downloaded (page.Url normalized inside fetcher)
 	FinalUrl    string // final url after all redirects
+	Method      string // http method of request (empty for GET)
+	Payload     string // body of request (urlencoded form data for POST)
+	Attempts    int    // count of fetching attempts
+	Proxy       string // proxy which served page (empty - direct connection)
 
 	IsFile   bool   // true - if Body contains bytes of downloaded file
 	FileName string // filename (from Content-Disposition header or FinalUrl)
+	Blob     string // name of blob with content of downloaded file in blob storage (Body is empty then)
+	Size     int64  // size of downloaded file
+	Sha256   string // checksum of downloaded file
+	Checksum string // expected sha256 of file published on referrer page (empty - not verified)
 
 	Body []byte // raw content of downloaded page  (TODO: gzip it)
 
-	err error // last error associated with page
+	Status      int           // http status code of last response
+	Headers     http.Header   // headers of last response
+	ContentType string        // Content-Type header of response
+	MediaType   string        // media type of content (from Content-Type header or sniffed from body)
+	Encoding    string        // detected charset of html page (body is kept as is and transcoded to UTF-8 for parsing)
+	Latency     time.Duration // time until response headers were received
+	Redirects   []string      // urls which were redirected to FinalUrl (in order of requests)
+
+	ETag         string    // validators of response for conditional requests on refresh
+	LastModified string    //
+	FetchedAt    time.Time // time of last fetch or successful revalidation
+
+	err    error // last error associated with page
+	cached *Page // stored copy of page which is revalidated by fetcher (nil - fetch unconditionally)
 
 	Tree *Block // parsed blocks on page
 
@@ -29,7 +52,16 @@ type Page struct {
 }
 
 type Block struct {
-	Fields map[string][]ValueOrBlock
+	Fields  map[string][]ValueOrBlock
+	Sources map[string][]*Source `msgpack:",omitempty"` // origin of every value in Fields (only if parser records provenance)
+	Keys    map[string][]string  `msgpack:",omitempty"` // storage keys of pages of form routes (values are their urls)
+}
+
+// Source describes where parsed value was taken from
+type Source struct {
+	Selector string // selector of route
+	Path     string // css path of matched node(s) in document
+	Url      string // url of page with this value
 }
 
 type ValueOrBlock interface{}
@@ -44,6 +76,16 @@ func NewPage(bytes []byte) *Page {
 	return &page
 }
 
+// Key identifies page in storage and among processed pages:
+// url for GET requests and method, url and payload for others
+// (so different POSTs to the same url aren't conflated)
+func (p *Page) Key() string {
+	if p.Method == "" || p.Method == "GET" {
+		return p.Url
+	}
+	return p.Method + " " + p.Url + "\n" + p.Payload
+}
+
 func (p *Page) Serialize() ([]byte, error) {
 	return msgpack.Marshal(p)
 }
@@ -2,14 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
 )
 
+var sha256Pattern = regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`) // longer hex runs (e.g. sha512) aren't cut into sha256 sums
+
 type Parser struct {
 	pagesConfigs  map[string]*ConfigEntity
 	blocksConfigs map[string]*ConfigEntity
@@ -20,6 +31,14 @@ type Parser struct {
 	queue  chan *Page
 
 	processed map[string]bool // set of urls (map keys) which already was processed (avoiding pages with self-references circular references and similar)
+
+	trace func(config *ConfigEntity, route *Route, sel *goquery.Selection) // optional hook called for every matched route
+
+	outOfScope      map[string]bool // links which were skipped because of scope rules
+	outOfScopeCount int64           // count of such links (for queue info)
+
+	Provenance bool   // record origin (selector, node path, url) of every parsed value
+	Scope      *Scope // nil - all found links are followed
 }
 
 func NewParser(config *Grammar, logist *Logist) *Parser {
@@ -32,7 +51,8 @@ func NewParser(config *Grammar, logist *Logist) *Parser {
 		errors: make(chan *Page),
 		queue:  make(chan *Page, 100000),
 
-		processed: make(map[string]bool),
+		processed:  make(map[string]bool),
+		outOfScope: make(map[string]bool),
 	}
 
 	for _, entity := range config.Entities {
@@ -47,21 +67,21 @@ func NewParser(config *Grammar, logist *Logist) *Parser {
 	return parser
 }
 
-func (p *Parser) Start() {
+func (p *Parser) Start(ctx context.Context) {
 	logrus.Info("parser: starting")
 
-	go p.processErrors()  // process parsing errors and errors from logist
-	go p.processLogist()  // take pages from logist and parse them
-	go p.processQueue()   // send from queue to logist (this goroutine is for avoiding deadlocks)
-	go p.printQueueInfo() // prints statistic every N seconds
-	go p.logist.Start()   // start logist
+	go p.processErrors()   // process parsing errors and errors from logist
+	go p.processLogist()   // take pages from logist and parse them
+	go p.processQueue(ctx) // send from queue to logist (this goroutine is for avoiding deadlocks)
+	go p.printQueueInfo()  // prints statistic every N seconds
+	p.logist.Start(ctx)    // start logist
 
 	// TODO: waiting until all queues are empty (and possibly rename method)
 }
 
 func (p *Parser) processErrors() {
 	inform := func(page *Page) {
-		logrus.WithField("url", page.Url).WithError(page.err).Error("parser: rejected [DROPPED TO NOWHERE]")
+		logrus.WithField("url", page.Url).WithField("attempts", page.Attempts).WithError(page.err).Error("parser: rejected [DROPPED TO NOWHERE]")
 	}
 	for {
 		select {
@@ -84,23 +104,23 @@ func (p *Parser) processLogist() {
 	}
 }
 
-func (p *Parser) processQueue() {
+func (p *Parser) processQueue(ctx context.Context) {
 	for page := range p.queue {
-		if p.processed[page.Url] {
+		if p.processed[page.Key()] {
 			logrus.WithField("url", page.Url).Printf("parser: skip page (already processed)")
 			continue
 		}
 
 		logrus.WithField("url", page.Url).Printf("parser: sending to logist")
-		p.logist.Fetch(page)
+		p.logist.Fetch(ctx, page)
 
-		p.processed[page.Url] = true // TODO: move to logist?
+		p.processed[page.Key()] = true // TODO: move to logist?
 	}
 }
 
 func (p *Parser) printQueueInfo() {
 	for {
-		logrus.WithField("items", len(p.queue)).Info("parser: queue info")
+		logrus.WithField("items", len(p.queue)).WithField("out_of_scope", atomic.LoadInt64(&p.outOfScopeCount)).Info("parser: queue info")
 		time.Sleep(10 * time.Second)
 	}
 }
@@ -111,7 +131,7 @@ func (p *Parser) Queue(page *Page) {
 
 func (p *Parser) parse(page *Page) {
 	logrus.WithField("url", page.Url).Info("parser: parsing fetched page")
-	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(page.Body))
+	doc, err := newDocument(page)
 
 	if err != nil {
 		p.dropPage(page, err)
@@ -128,57 +148,155 @@ func (p *Parser) parse(page *Page) {
 	//    /     ___ new pages for fetcher      ___ what to parse
 	//   /     /                              /              ___ how to parse
 	//  /     /                              /              /
-	tree, childPages := p.parseRecursive(doc.Selection, config)
+	tree, childPages := p.parseRecursive(page, doc.Selection, config)
 
 	page.Tree = tree
 	for _, childPage := range childPages {
-		childPage.ReferrerUrl = page.FullUrl // set important info for fetcher (for resolving relative page.Url)
+		childPage.ReferrerUrl = pageLocation(page) // set important info for fetcher (Referer header, resolving of page.Url if it's still relative)
+
+		if p.Scope != nil {
+			if reason := p.Scope.Check(childPage); reason != "" {
+				p.skipOutOfScope(childPage, reason)
+				continue
+			}
+		}
+
 		p.Queue(childPage)
 	}
 
 	//spew.Dump(page.Tree)
 }
 
-func (p *Parser) parseRecursive(doc *goquery.Selection, config *ConfigEntity) (*Block, []*Page) {
+// skipOutOfScope reports link which isn't followed (every link is reported once)
+func (p *Parser) skipOutOfScope(page *Page, reason string) {
+	if p.outOfScope[page.Key()] {
+		return
+	}
+	p.outOfScope[page.Key()] = true
+	atomic.AddInt64(&p.outOfScopeCount, 1)
+
+	logrus.WithField("url", page.Url).WithField("name", page.Name).WithField("reason", reason).Info("parser: skip link (out of scope)")
+}
+
+// newDocument builds html document from raw page body transcoded to UTF-8
+func newDocument(page *Page) (*goquery.Document, error) {
+	enc, _ := detectEncoding(page)
+	return goquery.NewDocumentFromReader(transform.NewReader(bytes.NewReader(page.Body), enc.NewDecoder()))
+}
+
+// detectEncoding returns encoding of page which was detected on fetching
+// or detects it by Content-Type header, <meta charset> and byte sniffing
+func detectEncoding(page *Page) (encoding.Encoding, string) {
+	if page.Encoding != "" {
+		if enc, name := charset.Lookup(page.Encoding); enc != nil {
+			return enc, name
+		}
+	}
+
+	enc, name, certain := charset.DetermineEncoding(page.Body, page.ContentType)
+	if !certain && utf8.Valid(page.Body) {
+		return charset.Lookup("utf-8") // undeclared ascii pages are detected as windows-1252
+	}
+
+	return enc, name
+}
+
+func (p *Parser) parseRecursive(page *Page, doc *goquery.Selection, config *ConfigEntity) (*Block, []*Page) {
 	// prepare place for savement
 	block := &Block{
 		Fields: make(map[string][]ValueOrBlock),
 	}
 
+	if p.Provenance {
+		block.Sources = make(map[string][]*Source)
+	}
+
 	pages := make([]*Page, 0) // all new pages for fetching will be saved here
+	files := make(map[string][]*Page)
 
 	for _, route := range config.Routes {
-		sel := doc.Find(route.Selector) // sub-document selection
+		sel := findSelector(doc, route.Selector) // sub-document selection (css or xpath)
+
+		if p.trace != nil {
+			p.trace(config, route, sel)
+		}
 
 		var (
-			data   []ValueOrBlock
-			pages_ []*Page
+			data    []ValueOrBlock
+			pages_  []*Page
+			origins []*goquery.Selection // nodes from which every value in data was taken
 		)
 
 		// TODO: mediator pattern?
 		switch route.Type {
 		case "page":
-			data, pages_ = p.parsePages(sel, route)
+			data, pages_, origins = p.parsePages(page, sel, route)
 		case "block":
-			data, pages_ = p.parseBlocks(sel, route)
+			data, pages_, origins = p.parseBlocks(page, sel, route)
 		case "file":
-			data, pages_ = p.downloadPages(sel, route)
+			data, pages_, origins = p.downloadPages(page, sel, route)
+		case "form":
+			data, pages_, origins = p.submitForms(page, sel, route)
 		}
 
 		block.Fields[route.Name] = data
 		pages = append(pages, pages_...)
+
+		if route.Type == "file" {
+			files[route.Name] = pages_
+		}
+
+		if route.Type == "form" {
+			if block.Keys == nil {
+				block.Keys = make(map[string][]string)
+			}
+			for _, submission := range pages_ {
+				block.Keys[route.Name] = append(block.Keys[route.Name], submission.Key())
+			}
+		}
+
+		if p.Provenance {
+			block.Sources[route.Name] = p.sources(page, route, origins)
+		}
 	}
 
+	p.attachChecksums(config, block, files)
+
 	return block, pages
 }
 
-func (p *Parser) parsePages(sel *goquery.Selection, route *Route) ([]ValueOrBlock, []*Page) {
+// attachChecksums sets expected sha256 of downloads from field which is declared by entity option
+// `checksum "<file route>" = "<field>"` (downloads and checksums are matched by their order)
+func (p *Parser) attachChecksums(config *ConfigEntity, block *Block, files map[string][]*Page) {
+	for _, option := range config.Find("checksum") {
+		sums := make([]string, 0)
+		for _, value := range block.Fields[option.Value] {
+			if text, ok := value.(string); ok {
+				sums = append(sums, sha256Pattern.FindAllString(text, -1)...)
+			}
+		}
+
+		downloads := files[option.Name]
+		if len(sums) != len(downloads) {
+			logrus.WithField("name", option.Name).WithField("files", len(downloads)).WithField("checksums", len(sums)).Warn("parser: count of checksums doesn't match count of files")
+		}
+
+		for i, page := range downloads {
+			if i < len(sums) {
+				page.Checksum = strings.ToLower(sums[i])
+			}
+		}
+	}
+}
+
+func (p *Parser) parsePages(page *Page, sel *goquery.Selection, route *Route) ([]ValueOrBlock, []*Page, []*goquery.Selection) {
 	logrus.WithField("name", route.Name).Info("parser: parsing pages")
 
 	values := make([]ValueOrBlock, 0)
 	pages := make([]*Page, 0)
 
-	for _, url := range p.extractUrls(sel) {
+	urls, origins := p.extractUrls(page, sel)
+	for _, url := range urls {
 		logrus.WithField("url", url).Info("parser: found new page")
 
 		values = append(values, url)
@@ -189,14 +307,15 @@ func (p *Parser) parsePages(sel *goquery.Selection, route *Route) ([]ValueOrBloc
 		})
 	}
 
-	return values, pages
+	return values, pages, origins
 }
 
-func (p *Parser) parseBlocks(sel *goquery.Selection, route *Route) ([]ValueOrBlock, []*Page) {
+func (p *Parser) parseBlocks(page *Page, sel *goquery.Selection, route *Route) ([]ValueOrBlock, []*Page, []*goquery.Selection) {
 	logrus.WithField("name", route.Name).Info("parser: parsing blocks")
 
 	values := make([]ValueOrBlock, 0)
 	pages := make([]*Page, 0)
+	origins := make([]*goquery.Selection, 0)
 
 	config, found := p.blocksConfigs[route.Name]
 
@@ -205,29 +324,31 @@ func (p *Parser) parseBlocks(sel *goquery.Selection, route *Route) ([]ValueOrBlo
 		logrus.WithField("name", route.Name).Info("parser: parsing block recursively...")
 
 		sel.Each(func(i int, sel *goquery.Selection) {
-			block, pages_ := p.parseRecursive(sel, config)
+			block, pages_ := p.parseRecursive(page, sel, config)
 
 			values = append(values, block)
 			pages = append(pages, pages_...)
+			origins = append(origins, sel)
 		})
-		return values, pages
+		return values, pages, origins
 
 	} else { // parse simple block which just simple text value
 
 		text := strings.TrimSpace(sel.Text())
 		logrus.WithField("value", text).Info("parser: found raw block")
-		return []ValueOrBlock{text}, nil
+		return []ValueOrBlock{text}, nil, []*goquery.Selection{sel}
 
 	}
 }
 
-func (p *Parser) downloadPages(sel *goquery.Selection, route *Route) ([]ValueOrBlock, []*Page) {
+func (p *Parser) downloadPages(page *Page, sel *goquery.Selection, route *Route) ([]ValueOrBlock, []*Page, []*goquery.Selection) {
 	logrus.WithField("name", route.Name).Info("parser: parsing downloads")
 
 	values := make([]ValueOrBlock, 0)
 	pages := make([]*Page, 0)
 
-	for _, url := range p.extractUrls(sel) {
+	urls, origins := p.extractUrls(page, sel)
+	for _, url := range urls {
 		logrus.WithField("url", url).Info("parser: found new download")
 
 		values = append(values, url)
@@ -239,13 +360,132 @@ func (p *Parser) downloadPages(sel *goquery.Selection, route *Route) ([]ValueOrB
 		})
 	}
 
-	return values, pages
+	return values, pages, origins
 }
 
-func (p *Parser) extractUrls(sel *goquery.Selection) []string {
+// submitForms fills matched forms with values from "field" options of route page
+// (other fields keep their default values) and returns pages with form submissions
+func (p *Parser) submitForms(page *Page, sel *goquery.Selection, route *Route) ([]ValueOrBlock, []*Page, []*goquery.Selection) {
+	logrus.WithField("name", route.Name).Info("parser: parsing forms")
+
+	values := make([]ValueOrBlock, 0)
+	pages := make([]*Page, 0)
+	origins := make([]*goquery.Selection, 0)
+
+	base := documentUrl(page, sel)
+
+	sel.Each(func(i int, sel *goquery.Selection) {
+		form := sel
+		if goquery.NodeName(sel) != "form" {
+			form = sel.Find("form").First()
+		}
+		if form.Length() == 0 {
+			return
+		}
+
+		action, _ := form.Attr("action")
+		actionUrl, err := url.Parse(action)
+		if err != nil {
+			logrus.WithField("action", action).WithError(err).Warn("parser: wrong form action")
+			return
+		}
+
+		switch {
+		case action == "" && base != nil:
+			actionUrl, _ = url.Parse(pageLocation(page)) // form without action is submitted to page itself (not to <base>)
+		case base != nil:
+			actionUrl = base.ResolveReference(actionUrl)
+		}
+
+		fields := formValues(form)
+		if config, found := p.pagesConfigs[route.Name]; found {
+			for _, option := range config.Find("field") {
+				fields.Set(option.Name, option.Value)
+			}
+		}
+
+		submission := &Page{Name: route.Name}
+
+		method, _ := form.Attr("method")
+		if method = strings.ToUpper(method); method == "POST" {
+			submission.Url = actionUrl.String()
+			submission.Method = method
+			submission.Payload = fields.Encode()
+		} else {
+			actionUrl.RawQuery = fields.Encode()
+			submission.Url = actionUrl.String()
+		}
+
+		logrus.WithField("url", submission.Url).WithField("method", submission.Method).Info("parser: found new form submission")
+
+		values = append(values, submission.Url) // key of POST submission isn't readable value (see Block.Keys)
+		pages = append(pages, submission)
+		origins = append(origins, form)
+	})
+
+	return values, pages, origins
+}
+
+// formValues collects default values of form fields (like browser does on submit)
+func formValues(form *goquery.Selection) url.Values {
+	values := make(url.Values)
+
+	form.Find("input[name], select[name], textarea[name]").Each(func(i int, field *goquery.Selection) {
+		name, _ := field.Attr("name")
+		if _, disabled := field.Attr("disabled"); disabled {
+			return
+		}
+
+		switch goquery.NodeName(field) {
+		case "input":
+			kind, _ := field.Attr("type")
+			switch strings.ToLower(kind) {
+			case "submit", "button", "image", "reset", "file":
+				return
+			case "checkbox", "radio":
+				if _, checked := field.Attr("checked"); !checked {
+					return
+				}
+				value, found := field.Attr("value")
+				if !found {
+					value = "on"
+				}
+				values.Add(name, value)
+			default:
+				value, _ := field.Attr("value")
+				values.Add(name, value)
+			}
+
+		case "select":
+			option := field.Find("option[selected]").First()
+			if option.Length() == 0 {
+				option = field.Find("option").First()
+			}
+			if option.Length() == 0 {
+				return
+			}
+			value, found := option.Attr("value")
+			if !found {
+				value = strings.TrimSpace(option.Text())
+			}
+			values.Add(name, value)
+
+		case "textarea":
+			values.Add(name, field.Text())
+		}
+	})
+
+	return values
+}
+
+// extractUrls returns found urls (absolute if page location is known) and nodes from which they were extracted
+func (p *Parser) extractUrls(page *Page, sel *goquery.Selection) ([]string, []*goquery.Selection) {
 	logrus.WithField("count", len(sel.Nodes)).Info("parser: extract urls from selector")
 
 	urls := make([]string, 0, len(sel.Nodes))
+	origins := make([]*goquery.Selection, 0, len(sel.Nodes))
+
+	base := documentUrl(page, sel)
 
 	sel.Each(func(idx int, sel *goquery.Selection) {
 		var url, found = "", false
@@ -263,11 +503,108 @@ func (p *Parser) extractUrls(sel *goquery.Selection) []string {
 		}
 
 		if found {
-			urls = append(urls, url)
+			urls = append(urls, resolveUrl(base, url))
+			origins = append(origins, sel)
 		}
 	})
 
-	return urls
+	return urls, origins
+}
+
+// documentUrl returns url for resolving links of page: <base href> of document
+// resolved against page location (nil - location of page isn't known, e.g. local file)
+func documentUrl(page *Page, sel *goquery.Selection) *url.URL {
+	pageUrl, err := url.Parse(pageLocation(page))
+	if err != nil || !pageUrl.IsAbs() || sel.Length() == 0 {
+		return nil
+	}
+
+	root := sel.Nodes[0]
+	for root.Parent != nil {
+		root = root.Parent
+	}
+
+	if base, found := goquery.NewDocumentFromNode(root).Find("base[href]").First().Attr("href"); found {
+		if baseUrl, err := url.Parse(strings.TrimSpace(base)); err == nil {
+			return pageUrl.ResolveReference(baseUrl)
+		}
+	}
+
+	return pageUrl
+}
+
+// pageLocation returns the most exact known url of page (after redirects if page was fetched)
+func pageLocation(page *Page) string {
+	switch {
+	case page.FinalUrl != "":
+		return page.FinalUrl
+	case page.FullUrl != "":
+		return page.FullUrl
+	}
+	return page.Url
+}
+
+// resolveUrl makes link absolute (links which can't be parsed are kept as is)
+func resolveUrl(base *url.URL, link string) string {
+	if base == nil {
+		return link
+	}
+
+	linkUrl, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return link
+	}
+
+	return base.ResolveReference(linkUrl).String()
+}
+
+// sources describes origin of every value parsed by route
+func (p *Parser) sources(page *Page, route *Route, origins []*goquery.Selection) []*Source {
+	url := pageLocation(page)
+
+	sources := make([]*Source, 0, len(origins))
+	for _, origin := range origins {
+		paths := make([]string, 0, len(origin.Nodes))
+		for _, node := range origin.Nodes {
+			paths = append(paths, nodePath(node))
+		}
+
+		sources = append(sources, &Source{
+			Selector: route.Selector,
+			Path:     strings.Join(paths, ", "),
+			Url:      url,
+		})
+	}
+
+	return sources
+}
+
+// nodePath builds css path of node in document (like "html > body > div:nth-child(2) > a:nth-child(1)")
+func nodePath(node *html.Node) string {
+	parts := make([]string, 0)
+
+	for ; node != nil && node.Type == html.ElementNode; node = node.Parent {
+		if node.Parent == nil || node.Parent.Type != html.ElementNode {
+			parts = append(parts, node.Data) // root element
+			continue
+		}
+
+		position := 1
+		for sibling := node.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+			if sibling.Type == html.ElementNode {
+				position++
+			}
+		}
+
+		parts = append(parts, fmt.Sprintf("%s:nth-child(%d)", node.Data, position))
+	}
+
+	// reverse from root to node
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	return strings.Join(parts, " > ")
 }
 
 func (p *Parser) dropPage(page *Page, err error) {
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAttachChecksums(t *testing.T) {
+	sum1 := strings.Repeat("ab", 32)
+	sum2 := strings.Repeat("CD", 32)
+	sha512 := strings.Repeat("ef", 64)
+
+	tests := []struct {
+		name  string
+		sums  string
+		links int
+		want  []string
+	}{
+		{"separate", sum1 + " file1.zip\n" + sum2 + " file2.zip", 2, []string{sum1, strings.ToLower(sum2)}},
+		{"table", "|" + sum1 + "|file1.zip|\n|" + sum2 + "|file2.zip|", 2, []string{sum1, strings.ToLower(sum2)}},
+		{"sha512", sha512 + " file1.zip\n" + sha512 + " file2.zip", 2, []string{"", ""}},
+		{"missed checksum", sum1, 2, []string{sum1, ""}},
+		{"no checksums", "see release notes", 1, []string{""}},
+	}
+
+	config, err := parseConfig(`
+		page "release" {
+		  checksum "archive" = "sums"
+		  "a.download" -> file "archive"
+		  "pre.sums" -> block "sums"
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		body := &strings.Builder{}
+		for i := 0; i < test.links; i++ {
+			fmt.Fprintf(body, `<a class="download" href="/file%d.zip">file</a>`, i+1)
+		}
+		body.WriteString(`<pre class="sums">` + test.sums + `</pre>`)
+
+		page := &Page{Name: "release", Url: "http://example.com/", FullUrl: "http://example.com/", Body: []byte(body.String())}
+		doc, err := newDocument(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parser := NewParser(config, nil)
+		_, pages := parser.parseRecursive(page, doc.Selection, parser.pagesConfigs["release"])
+
+		if len(pages) != len(test.want) {
+			t.Fatalf("%s: %d downloads, want %d", test.name, len(pages), len(test.want))
+		}
+		for i, download := range pages {
+			if download.Checksum != test.want[i] {
+				t.Errorf("%s: checksum of %s = %q, want %q", test.name, download.Url, download.Checksum, test.want[i])
+			}
+		}
+	}
+}
+
+func TestParseReferrer(t *testing.T) {
+	config, err := parseConfig(`
+		page "list" {
+		  "a.item" -> page "item"
+		}
+		page "item" {
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// list was fetched after redirect, so its links are relative to final location
+	page := &Page{
+		Name:     "list",
+		Url:      "http://example.com/list",
+		FullUrl:  "http://example.com/list",
+		FinalUrl: "http://example.com/catalog/list",
+		Body:     []byte(`<a class="item" href="items/1">item</a>`),
+	}
+
+	parser := NewParser(config, nil)
+	parser.parse(page)
+
+	if len(parser.queue) != 1 {
+		t.Fatalf("%d pages are queued, want 1", len(parser.queue))
+	}
+
+	child := <-parser.queue
+	if child.ReferrerUrl != page.FinalUrl {
+		t.Errorf("referrer = %q, want final url of parent %q", child.ReferrerUrl, page.FinalUrl)
+	}
+	if child.Url != "http://example.com/catalog/items/1" {
+		t.Errorf("url = %q, want link resolved against final url of parent", child.Url)
+	}
+}
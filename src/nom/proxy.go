@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrNoProxies = errors.New("all proxies are unhealthy")
+
+// ProxyPool assigns http/socks proxies to requests (round-robin or sticky per host)
+// and excludes proxies with consecutive failures for a while
+type ProxyPool struct {
+	Sticky      bool          // use the same proxy for all requests to host while it's healthy
+	MaxFailures int           // count of consecutive failures after which proxy becomes unhealthy
+	Cooldown    time.Duration // time after which unhealthy proxy is tried again
+
+	mutex   sync.Mutex
+	proxies []*poolProxy
+	next    int                   // next proxy for round-robin
+	hosts   map[string]*poolProxy // sticky proxies of hosts
+}
+
+type poolProxy struct {
+	url       *url.URL
+	failures  int
+	unhealthy time.Time // zero - proxy is healthy
+}
+
+// proxyChoice is filled by fetcher's transport with proxy which was used for request
+type proxyChoice struct {
+	url *url.URL
+}
+
+type proxyChoiceKey struct{}
+
+func NewProxyPool(urls []string) (*ProxyPool, error) {
+	pool := &ProxyPool{
+		MaxFailures: 3,
+		Cooldown:    5 * time.Minute,
+
+		hosts: make(map[string]*poolProxy),
+	}
+
+	for _, rawUrl := range urls {
+		proxyUrl, err := url.Parse(rawUrl)
+		if err != nil {
+			return nil, err
+		}
+		pool.proxies = append(pool.proxies, &poolProxy{url: proxyUrl})
+	}
+
+	return pool, nil
+}
+
+// LoadProxies reads proxy urls from file (one per line, lines starting with # are ignored)
+func LoadProxies(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	urls := make([]string, 0)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+
+	return urls, scanner.Err()
+}
+
+// Pick returns proxy for request to host (nil - there are no healthy proxies)
+func (p *ProxyPool) Pick(host string) *url.URL {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if proxy, found := p.hosts[host]; found && p.healthy(proxy) {
+		return proxy.url
+	}
+
+	for range p.proxies {
+		proxy := p.proxies[p.next]
+		p.next = (p.next + 1) % len(p.proxies)
+
+		if p.healthy(proxy) {
+			if p.Sticky {
+				p.hosts[host] = proxy
+			}
+			return proxy.url
+		}
+	}
+
+	return nil
+}
+
+// Report updates health of proxy after request to host
+func (p *ProxyPool) Report(host string, proxyUrl *url.URL, success bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, proxy := range p.proxies {
+		if proxy.url != proxyUrl {
+			continue
+		}
+
+		if success {
+			proxy.failures = 0
+			return
+		}
+
+		proxy.failures++
+		delete(p.hosts, host) // next request to host goes through another proxy
+
+		if proxy.failures >= p.MaxFailures && proxy.unhealthy.IsZero() {
+			proxy.unhealthy = time.Now()
+			logrus.WithField("proxy", redactUrl(proxy.url)).WithField("failures", proxy.failures).Warn("proxy: marked as unhealthy")
+		}
+	}
+}
+
+// healthy checks that proxy is healthy or its cooldown is over
+func (p *ProxyPool) healthy(proxy *poolProxy) bool {
+	if proxy.unhealthy.IsZero() {
+		return true
+	}
+
+	if time.Since(proxy.unhealthy) > p.Cooldown {
+		logrus.WithField("proxy", redactUrl(proxy.url)).Info("proxy: trying unhealthy proxy again")
+		proxy.unhealthy = time.Time{}
+		proxy.failures = p.MaxFailures - 1 // one more failure makes it unhealthy again
+		return true
+	}
+
+	return false
+}
+
+// redactUrl hides password of url (for logs)
+func redactUrl(u *url.URL) string {
+	if _, found := u.User.Password(); !found {
+		return u.String()
+	}
+
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return redacted.String()
+}
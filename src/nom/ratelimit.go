@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minThrottleInterval = 1 * time.Second        // interval after throttling signal when no delay was configured
+	maxThrottleInterval = 10 * time.Minute       // the slowest rate for throttling host
+	slowLatency         = 500 * time.Millisecond // smaller latencies are not considered as server slowdown
+)
+
+// RateLimiter is token bucket per host which slows down on throttling signals from server
+// (429, 503, Retry-After, rising latency) and gradually speeds back up to configured ceiling.
+type RateLimiter struct {
+	mutex sync.Mutex
+	hosts map[string]*bucket
+}
+
+type bucket struct {
+	ceiling  time.Duration // the fastest allowed rate (as min interval between requests)
+	interval time.Duration // current interval between requests
+	tokens   float64       // available requests (bucket capacity is one request)
+	refilled time.Time     // time of last tokens refilling
+	blocked  time.Time     // no requests until this time (from Retry-After header)
+	latency  time.Duration // moving average of responses latency
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		hosts: make(map[string]*bucket),
+	}
+}
+
+// Wait blocks until request to host is allowed (ceiling is configured min interval between requests)
+// or context is canceled
+func (r *RateLimiter) Wait(ctx context.Context, host string, ceiling time.Duration) error {
+	for {
+		delay := r.reserve(host, ceiling)
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes token from host bucket or returns time to wait for it
+func (r *RateLimiter) reserve(host string, ceiling time.Duration) time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	b, found := r.hosts[host]
+	if !found {
+		b = &bucket{
+			interval: ceiling,
+			tokens:   1,
+			refilled: now,
+		}
+		r.hosts[host] = b
+	}
+
+	// ceiling may grow (e.g. Crawl-delay from robots.txt)
+	b.ceiling = ceiling
+	if b.interval < ceiling {
+		b.interval = ceiling
+	}
+
+	if now.Before(b.blocked) {
+		return b.blocked.Sub(now)
+	}
+
+	if b.interval <= 0 {
+		return 0
+	}
+
+	b.tokens += float64(now.Sub(b.refilled)) / float64(b.interval)
+	if b.tokens > 1 {
+		b.tokens = 1
+	}
+	b.refilled = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) * float64(b.interval))
+}
+
+// Observe adapts rate of host by server response
+func (r *RateLimiter) Observe(host string, res *http.Response, latency time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b, found := r.hosts[host]
+	if !found {
+		return // request wasn't limited at all
+	}
+
+	interval := b.interval
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		interval *= 2
+		if interval < minThrottleInterval {
+			interval = minThrottleInterval
+		}
+
+		if retryAfter := parseRetryAfter(res.Header.Get("Retry-After")); retryAfter > 0 {
+			b.blocked = time.Now().Add(retryAfter)
+			logrus.WithField("host", host).WithField("retry_after", retryAfter).Warn("ratelimit: server asks to retry later")
+		}
+
+	case b.latency > 0 && latency > 2*b.latency && latency > slowLatency:
+		interval = interval * 3 / 2 // server is getting slower
+
+	default:
+		interval = interval * 9 / 10 // speed up
+	}
+
+	if interval > maxThrottleInterval {
+		interval = maxThrottleInterval
+	}
+	if interval < b.ceiling {
+		interval = b.ceiling
+	}
+
+	if b.latency == 0 {
+		b.latency = latency
+	} else {
+		b.latency = (b.latency*4 + latency) / 5
+	}
+
+	if interval != b.interval {
+		rate := "unlimited"
+		if interval > 0 {
+			rate = strconv.FormatFloat(float64(time.Second)/float64(interval), 'f', 3, 64) + " req/s"
+		}
+
+		logrus.WithField("host", host).WithField("interval", interval).WithField("rate", rate).WithField("latency", b.latency).Info("ratelimit: rate changed")
+		b.interval = interval
+	}
+}
+
+// parseRetryAfter parses Retry-After header (delay in seconds or http date)
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterObserve(t *testing.T) {
+	tests := []struct {
+		name       string
+		ceiling    time.Duration
+		interval   time.Duration
+		latency    time.Duration // moving average before response
+		status     int
+		retryAfter string
+		took       time.Duration // latency of response
+		want       time.Duration
+		blocked    bool
+	}{
+		{"speed up", time.Second, 4 * time.Second, 0, 200, "", 100 * time.Millisecond, 3600 * time.Millisecond, false},
+		{"not faster than ceiling", time.Second, time.Second, 0, 200, "", 100 * time.Millisecond, time.Second, false},
+		{"too many requests", time.Second, 4 * time.Second, 0, 429, "", 100 * time.Millisecond, 8 * time.Second, false},
+		{"unavailable without delay", 0, 0, 0, 503, "", 100 * time.Millisecond, minThrottleInterval, false},
+		{"retry after", time.Second, time.Second, 0, 429, "30", 100 * time.Millisecond, 2 * time.Second, true},
+		{"slowing down", time.Second, 4 * time.Second, 200 * time.Millisecond, 200, "", time.Second, 6 * time.Second, false},
+		{"fast latency spike", time.Second, 4 * time.Second, 100 * time.Millisecond, 200, "", 300 * time.Millisecond, 3600 * time.Millisecond, false},
+		{"not slower than max", time.Second, maxThrottleInterval, 0, 429, "", 100 * time.Millisecond, maxThrottleInterval, false},
+	}
+
+	for _, test := range tests {
+		limiter := NewRateLimiter()
+		limiter.reserve("example.com", test.ceiling)
+
+		b := limiter.hosts["example.com"]
+		b.interval = test.interval
+		b.latency = test.latency
+
+		res := &http.Response{StatusCode: test.status, Header: make(http.Header)}
+		if test.retryAfter != "" {
+			res.Header.Set("Retry-After", test.retryAfter)
+		}
+
+		limiter.Observe("example.com", res, test.took)
+
+		if b.interval != test.want {
+			t.Errorf("%s: interval = %s, want %s", test.name, b.interval, test.want)
+		}
+		if blocked := time.Now().Before(b.blocked); blocked != test.blocked {
+			t.Errorf("%s: blocked = %v, want %v", test.name, blocked, test.blocked)
+		}
+	}
+}
+
+func TestRateLimiterObserveUnknownHost(t *testing.T) {
+	limiter := NewRateLimiter()
+	limiter.Observe("example.com", &http.Response{StatusCode: 429, Header: make(http.Header)}, time.Second)
+
+	if _, found := limiter.hosts["example.com"]; found {
+		t.Error("bucket is created for host which wasn't limited")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{"soon", 0, 0},
+	}
+
+	for _, test := range tests {
+		if delay := parseRetryAfter(test.header); delay < test.min || delay > test.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", test.header, delay, test.min, test.max)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrRedirectLoop     = errors.New("redirect loop")
+	ErrOffsiteRedirect  = errors.New("redirect to another host")
+)
+
+// RedirectPolicy limits redirects of requests. Limits may be overridden by options
+// of "global" and page entities, also pages may be marked as failed by their final url:
+//
+//	page "item" {
+//	  redirect "max" = "3"
+//	  redirect "host" = "same"    // or "any"
+//	  error "url" = "/login\\b"   // regular expression
+//	}
+type RedirectPolicy struct {
+	MaxHops  int  // max count of redirects of single request (0 - redirect response itself is returned)
+	SameHost bool // follow redirects only within host of request
+
+	mutex   sync.Mutex
+	regexps map[string]*regexp.Regexp // compiled "error" rules
+}
+
+func NewRedirectPolicy(maxHops int, sameHost bool) *RedirectPolicy {
+	return &RedirectPolicy{
+		MaxHops:  maxHops,
+		SameHost: sameHost,
+
+		regexps: make(map[string]*regexp.Regexp),
+	}
+}
+
+// Check decides whether redirect of page request is followed (see http.Client.CheckRedirect),
+// every followed hop is recorded in page.Redirects (page may be nil, e.g. for login requests)
+func (r *RedirectPolicy) Check(config *Grammar, page *Page, req *http.Request, via []*http.Request) error {
+	maxHops, sameHost := r.limits(config, page)
+	if maxHops == 0 {
+		return http.ErrUseLastResponse // 3xx is checked like any other unsuccessful status
+	}
+
+	for _, prev := range via {
+		if prev.Method == req.Method && prev.URL.String() == req.URL.String() {
+			return ErrRedirectLoop
+		}
+	}
+
+	if len(via) > maxHops {
+		return ErrTooManyRedirects
+	}
+
+	if sameHost && req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%w (%s)", ErrOffsiteRedirect, req.URL.Host)
+	}
+
+	from := via[len(via)-1].URL.String()
+	logrus.WithField("from", from).WithField("to", req.URL.String()).Info("fetcher: following redirect")
+
+	if page != nil {
+		page.Redirects = append(page.Redirects, from)
+	}
+
+	return nil
+}
+
+// limits returns max count of redirects and same host restriction for page
+func (r *RedirectPolicy) limits(config *Grammar, page *Page) (int, bool) {
+	maxHops, sameHost := r.MaxHops, r.SameHost
+	if config == nil || page == nil {
+		return maxHops, sameHost
+	}
+
+	if value, found := config.Setting(page.Name, "redirect", "max"); found {
+		hops, err := strconv.Atoi(value)
+		if err != nil {
+			logrus.WithField("name", page.Name).WithField("value", value).Warn("fetcher: wrong max count of redirects")
+		} else {
+			maxHops = hops
+		}
+	}
+
+	if value, found := config.Setting(page.Name, "redirect", "host"); found {
+		sameHost = value == "same"
+	}
+
+	return maxHops, sameHost
+}
+
+// CheckFinalUrl returns error if final url of page matches "error" rules of config
+func (r *RedirectPolicy) CheckFinalUrl(config *Grammar, page *Page) error {
+	if config == nil {
+		return nil
+	}
+
+	for _, option := range config.Settings(page.Name, "error") {
+		if option.Name != "url" {
+			continue
+		}
+
+		re, err := r.regexp(option.Value)
+		if err != nil {
+			return err
+		}
+
+		if re.MatchString(page.FinalUrl) {
+			return fmt.Errorf("final url \"%s\" matches error rule \"%s\"", page.FinalUrl, option.Value)
+		}
+	}
+
+	return nil
+}
+
+func (r *RedirectPolicy) regexp(pattern string) (*regexp.Regexp, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if re, found := r.regexps[pattern]; found {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("wrong error rule \"%s\": %s", pattern, err)
+	}
+
+	r.regexps[pattern] = re
+	return re, nil
+}
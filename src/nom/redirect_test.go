@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectPolicyCheck(t *testing.T) {
+	config, err := parseConfig(`
+		page "strict" {
+		  redirect "max" = "1"
+		  redirect "host" = "same"
+		}
+		page "direct" {
+		  redirect "max" = "0"
+		}
+		page "any" {
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string // page name
+		via  []string
+		to   string
+		err  error // nil - redirect is followed
+	}{
+		{"any", []string{"http://example.com/a"}, "http://example.com/b", nil},
+		{"any", []string{"http://example.com/a"}, "http://other.com/b", nil},
+		{"any", []string{"http://example.com/a", "http://example.com/b"}, "http://example.com/a", ErrRedirectLoop},
+		{"any", []string{"http://example.com/a"}, "http://example.com/a", ErrRedirectLoop},
+		{"any", []string{"http://example.com/1", "http://example.com/2", "http://example.com/3"}, "http://example.com/4", ErrTooManyRedirects},
+		{"strict", []string{"http://example.com/a"}, "http://example.com/b", nil},
+		{"strict", []string{"http://example.com/a", "http://example.com/b"}, "http://example.com/c", ErrTooManyRedirects},
+		{"strict", []string{"http://example.com/a"}, "http://other.com/b", ErrOffsiteRedirect},
+		{"direct", []string{"http://example.com/a"}, "http://example.com/b", http.ErrUseLastResponse},
+	}
+
+	for _, test := range tests {
+		policy := NewRedirectPolicy(2, false)
+		page := &Page{Name: test.name}
+
+		via := make([]*http.Request, 0, len(test.via))
+		for _, url := range test.via {
+			via = append(via, httptest.NewRequest("GET", url, nil))
+		}
+
+		err := policy.Check(config, page, httptest.NewRequest("GET", test.to, nil), via)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s %v -> %s: error = %v, want %v", test.name, test.via, test.to, err, test.err)
+		}
+
+		if err == nil && page.Redirects[len(page.Redirects)-1] != test.via[len(test.via)-1] {
+			t.Errorf("%s %v -> %s: hop isn't recorded in %v", test.name, test.via, test.to, page.Redirects)
+		}
+	}
+}
+
+func TestRedirectPolicyLoopAcrossMethods(t *testing.T) {
+	policy := NewRedirectPolicy(10, false)
+
+	// POST to url and then GET of the same url (post/redirect/get) isn't loop
+	via := []*http.Request{httptest.NewRequest("POST", "http://example.com/form", nil)}
+	if err := policy.Check(nil, nil, httptest.NewRequest("GET", "http://example.com/form", nil), via); err != nil {
+		t.Errorf("error = %v for post/redirect/get", err)
+	}
+}
+
+func TestRedirectPolicyCheckFinalUrl(t *testing.T) {
+	config, err := parseConfig(`
+		global "errors" {
+		  error "url" = "/login\\b"
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url string
+		err bool
+	}{
+		{"http://example.com/items/1", false},
+		{"http://example.com/login?next=/items/1", true},
+		{"http://example.com/loginhelp", false},
+	}
+
+	policy := NewRedirectPolicy(10, false)
+	for _, test := range tests {
+		err := policy.CheckFinalUrl(config, &Page{FinalUrl: test.url})
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v, want error %v", test.url, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const replHelp = `<selector>            test css selector or xpath expression (e.g. .//li[@class="item"]) inside current selection
+:route <type> <name>  save last tested selector as route (type is page, block, file or form)
+:in <name>            save last tested selector as block route and step into its matches
+:up                   step out to parent selection
+:emit                 print saved routes in config syntax
+:help                 show this help
+:quit                 exit`
+
+// Repl is interactive shell for testing selectors against single page
+type Repl struct {
+	in  io.Reader
+	out io.Writer
+
+	levels   []*replLevel    // stack of selections (first one is whole document)
+	entities []*ConfigEntity // saved entities in order of creation
+
+	last    string             // last tested selector
+	lastSel *goquery.Selection // ... and its matches
+}
+
+type replLevel struct {
+	entity    *ConfigEntity
+	selection *goquery.Selection
+}
+
+func NewRepl(page *Page, in io.Reader, out io.Writer) (*Repl, error) {
+	doc, err := newDocument(page)
+	if err != nil {
+		return nil, err
+	}
+
+	name := page.Name
+	if name == "" {
+		name = "page"
+	}
+
+	root := &ConfigEntity{
+		Type: "page",
+		Name: name,
+	}
+
+	return &Repl{
+		in:  in,
+		out: out,
+
+		levels:   []*replLevel{{entity: root, selection: doc.Selection}},
+		entities: []*ConfigEntity{root},
+	}, nil
+}
+
+// loadSource loads page from local html file or (if there is no such file) from storage
+func loadSource(storage Storage, source string) (*Page, error) {
+	if _, err := os.Stat(source); err == nil {
+		body, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Page{Url: source, Body: body}, nil
+	}
+
+	return findPage(storage, source)
+}
+
+func (r *Repl) Run() {
+	fmt.Fprintln(r.out, "type :help for list of commands")
+
+	scanner := bufio.NewScanner(r.in)
+	for r.prompt(); scanner.Scan(); r.prompt() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, ":") {
+			r.test(line)
+			continue
+		}
+
+		args := strings.Fields(line)
+		switch args[0] {
+		case ":route":
+			if len(args) != 3 {
+				fmt.Fprintln(r.out, "usage: :route <type> <name>")
+				continue
+			}
+			r.route(args[1], args[2])
+		case ":in":
+			if len(args) != 2 {
+				fmt.Fprintln(r.out, "usage: :in <name>")
+				continue
+			}
+			r.stepIn(args[1])
+		case ":up":
+			r.stepOut()
+		case ":emit":
+			r.emit()
+		case ":help":
+			fmt.Fprintln(r.out, replHelp)
+		case ":quit", ":q":
+			return
+		default:
+			fmt.Fprintf(r.out, "unknown command \"%s\" (type :help)\n", args[0])
+		}
+	}
+}
+
+func (r *Repl) prompt() {
+	names := make([]string, 0, len(r.levels))
+	for _, level := range r.levels {
+		names = append(names, level.entity.Name)
+	}
+
+	fmt.Fprintf(r.out, "%s> ", strings.Join(names, "/"))
+}
+
+func (r *Repl) current() *replLevel {
+	return r.levels[len(r.levels)-1]
+}
+
+func (r *Repl) test(selector string) {
+	sel, err := selectNodes(r.current().selection, selector)
+	if err != nil {
+		fmt.Fprintf(r.out, "wrong xpath expression: %s\n", err)
+		return
+	}
+
+	r.last, r.lastSel = selector, sel
+
+	fmt.Fprintf(r.out, "%d matches\n", sel.Length())
+	sel.EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		if i == 10 {
+			fmt.Fprintf(r.out, "  ... and %d more\n", r.lastSel.Length()-i)
+			return false
+		}
+
+		text := truncateText(normalizeText(sel.Text()), 80)
+		fmt.Fprintf(r.out, "  [%d] <%s> %s\n", i, goquery.NodeName(sel), text)
+		return true
+	})
+}
+
+func (r *Repl) route(kind string, name string) {
+	if r.last == "" {
+		fmt.Fprintln(r.out, "test some selector first")
+		return
+	}
+
+	switch kind {
+	case "page", "block", "file", "form":
+	default:
+		fmt.Fprintf(r.out, "unknown route type \"%s\"\n", kind)
+		return
+	}
+
+	entity := r.current().entity
+	for _, route := range entity.Routes {
+		if route.Selector == r.last && route.Name == name {
+			route.Type = kind // route is saved again (e.g. stepping into the same block)
+			fmt.Fprintf(r.out, "updated in %s \"%s\"\n", entity.Type, entity.Name)
+			return
+		}
+	}
+
+	entity.Routes = append(entity.Routes, &Route{
+		Selector: r.last,
+		Type:     kind,
+		Name:     name,
+	})
+
+	fmt.Fprintf(r.out, "saved to %s \"%s\"\n", entity.Type, entity.Name)
+}
+
+func (r *Repl) stepIn(name string) {
+	if r.last == "" || r.lastSel.Length() == 0 {
+		fmt.Fprintln(r.out, "test some selector with matches first")
+		return
+	}
+
+	r.route("block", name)
+
+	var entity *ConfigEntity
+	for _, e := range r.entities {
+		if e.Type == "block" && e.Name == name {
+			entity = e // stepping into the same block again
+		}
+	}
+
+	if entity == nil {
+		entity = &ConfigEntity{
+			Type: "block",
+			Name: name,
+		}
+		r.entities = append(r.entities, entity)
+	}
+
+	r.levels = append(r.levels, &replLevel{entity: entity, selection: r.lastSel})
+
+	r.last, r.lastSel = "", nil
+}
+
+func (r *Repl) stepOut() {
+	if len(r.levels) == 1 {
+		fmt.Fprintln(r.out, "already at top level")
+		return
+	}
+
+	r.levels = r.levels[:len(r.levels)-1]
+	r.last, r.lastSel = "", nil
+}
+
+func (r *Repl) emit() {
+	for _, entity := range r.entities {
+		fmt.Fprintln(r.out, entity.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// FetchError describes failed fetching of page
+type FetchError struct {
+	Status    int  // http status code (zero for network errors)
+	Temporary bool // transient failure, page may be fetched successfully later
+	Err       error
+}
+
+func (e *FetchError) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("server returns error code %d", e.Status)
+	}
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// RetryPolicy describes how transient failures are retried
+type RetryPolicy struct {
+	Attempts  int           // max count of attempts for single page (1 - no retries)
+	BaseDelay time.Duration // delay before first retry (doubled for every next one)
+	MaxDelay  time.Duration // max delay between retries
+}
+
+// Backoff returns jittered delay before next attempt (attempt is count of already failed attempts)
+func (r *RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := r.BaseDelay
+	for i := 1; i < attempt && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+
+	// random delay between [delay/2, delay) to spread retries of simultaneously failed pages
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Retryable checks that page failed with transient error and has attempts left
+func (r *RetryPolicy) Retryable(page *Page) bool {
+	fetchErr, ok := page.err.(*FetchError)
+	return ok && fetchErr.Temporary && page.Attempts < r.Attempts
+}
+
+// statusError classifies unsuccessful http status code
+func statusError(status int) *FetchError {
+	return &FetchError{
+		Status:    status,
+		Temporary: status == http.StatusTooManyRequests || status >= 500,
+	}
+}
+
+// networkError classifies error of request or reading of response:
+// timeouts and dropped connections are temporary, everything else (e.g. invalid url) is permanent
+func networkError(err error) *FetchError {
+	temporary := false
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		temporary = true
+	}
+
+	for _, transient := range []error{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE, io.ErrUnexpectedEOF, io.EOF, ErrNoProxies, ErrHeaderTimeout, ErrIdleTimeout, context.DeadlineExceeded} {
+		if errors.Is(err, transient) {
+			temporary = true
+		}
+	}
+
+	return &FetchError{
+		Temporary: temporary,
+		Err:       err,
+	}
+}
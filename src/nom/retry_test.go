@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status    int
+		temporary bool
+	}{
+		{301, false},
+		{400, false},
+		{403, false},
+		{404, false},
+		{416, false},
+		{429, true},
+		{500, true},
+		{502, true},
+		{503, true},
+	}
+
+	for _, test := range tests {
+		err := statusError(test.status)
+		if err.Status != test.status || err.Temporary != test.temporary {
+			t.Errorf("statusError(%d) = %+v, want temporary %v", test.status, err, test.temporary)
+		}
+	}
+}
+
+func TestNetworkError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		temporary bool
+	}{
+		{"timeout", &url.Error{Op: "Get", URL: "http://example.com", Err: timeoutErr{}}, true},
+		{"reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"eof", &url.Error{Op: "Get", URL: "http://example.com", Err: io.EOF}, true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"no proxies", ErrNoProxies, true},
+		{"header timeout", ErrHeaderTimeout, true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New("unsupported protocol scheme")}, false},
+	}
+
+	for _, test := range tests {
+		err := networkError(test.err)
+		if err.Temporary != test.temporary {
+			t.Errorf("%s: temporary = %v, want %v", test.name, err.Temporary, test.temporary)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: original error isn't wrapped", test.name)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := &RetryPolicy{Attempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{4, 4 * time.Second, 8 * time.Second},
+		{5, 5 * time.Second, 10 * time.Second}, // capped by max delay
+		{100, 5 * time.Second, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			delay := policy.Backoff(test.attempt)
+			if delay < test.min || delay > test.max {
+				t.Fatalf("Backoff(%d) = %s, want between %s and %s", test.attempt, delay, test.min, test.max)
+			}
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	policy := &RetryPolicy{Attempts: 3}
+
+	tests := []struct {
+		name      string
+		err       error
+		attempts  int
+		retryable bool
+	}{
+		{"temporary", &FetchError{Temporary: true}, 1, true},
+		{"last attempt", &FetchError{Temporary: true}, 3, false},
+		{"permanent", &FetchError{Status: 404}, 1, false},
+		{"not fetch error", errors.New("unknown page type"), 1, false},
+	}
+
+	for _, test := range tests {
+		page := &Page{Attempts: test.attempts, err: test.err}
+		if retryable := policy.Retryable(page); retryable != test.retryable {
+			t.Errorf("%s: Retryable = %v, want %v", test.name, retryable, test.retryable)
+		}
+	}
+}
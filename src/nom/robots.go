@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/temoto/robotstxt"
+)
+
+var ErrRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+const (
+	robotsTimeout = 30 * time.Second // hanging robots.txt mustn't stall all requests to host
+	robotsRetry   = time.Minute      // failed robots.txt (network errors, 5xx) is fetched again after this delay
+)
+
+// Robots fetches and caches robots.txt of every host and checks urls against its rules
+type Robots struct {
+	Agent  string          // user agent for matching robots.txt groups
+	Ignore map[string]bool // hosts which we have permission to crawl regardless of their robots.txt
+	Auth   *Auth           // credentials of hosts (nil - robots.txt is requested without them)
+
+	client *http.Client
+
+	mutex sync.Mutex
+	hosts map[string]*robotsHost
+}
+
+type robotsHost struct {
+	mutex   sync.Mutex // held while robots.txt is loading
+	loaded  bool
+	expires time.Time // zero - robots.txt was loaded successfully and is kept for the whole crawl
+
+	data *robotstxt.RobotsData // nil - robots.txt wasn't loaded (everything is allowed)
+}
+
+func NewRobots(agent string, client *http.Client) *Robots {
+	return &Robots{
+		Agent:  agent,
+		Ignore: make(map[string]bool),
+
+		client: client,
+		hosts:  make(map[string]*robotsHost),
+	}
+}
+
+// Check returns ErrRobotsDisallowed if url is disallowed by robots.txt of its host (robots.txt is fetched
+// at first call for host), the error is temporary while robots.txt is failing with server errors
+func (r *Robots) Check(ctx context.Context, pageUrl *url.URL) error {
+	if r.Ignore[pageUrl.Host] {
+		return nil
+	}
+
+	data, failed := r.load(ctx, pageUrl)
+	if data == nil || data.TestAgent(pageUrl.RequestURI(), r.Agent) {
+		return nil
+	}
+
+	if failed {
+		return &FetchError{Temporary: true, Err: ErrRobotsDisallowed}
+	}
+	return ErrRobotsDisallowed
+}
+
+// CrawlDelay returns delay requested by robots.txt of host (zero if robots.txt wasn't loaded yet)
+func (r *Robots) CrawlDelay(host string) time.Duration {
+	if r.Ignore[host] {
+		return 0
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	robots, found := r.hosts[host]
+	if !found || robots.data == nil {
+		return 0
+	}
+
+	return robots.data.FindGroup(r.Agent).CrawlDelay
+}
+
+// load returns rules of host and whether they are temporary because of failure
+func (r *Robots) load(ctx context.Context, pageUrl *url.URL) (*robotstxt.RobotsData, bool) {
+	r.mutex.Lock()
+	robots, found := r.hosts[pageUrl.Host]
+	if !found {
+		robots = &robotsHost{}
+		r.hosts[pageUrl.Host] = robots
+	}
+	r.mutex.Unlock()
+
+	// NOTE: other requests to the same host are waiting here until robots.txt is loaded
+	robots.mutex.Lock()
+	defer robots.mutex.Unlock()
+
+	if robots.loaded && (robots.expires.IsZero() || time.Now().Before(robots.expires)) {
+		return robots.data, !robots.expires.IsZero()
+	}
+
+	data, err := r.fetch(ctx, pageUrl)
+
+	robots.loaded = true
+	robots.expires = time.Time{}
+	if err != nil {
+		robots.expires = time.Now().Add(robotsRetry) // don't keep transient failure for the whole crawl
+	}
+
+	r.mutex.Lock()
+	robots.data = data
+	r.mutex.Unlock()
+
+	return data, err != nil
+}
+
+// fetch loads robots.txt of host of url, error is returned for failures which may be transient
+// (rules for them are allowing everything for network errors or disallowing everything for 5xx)
+func (r *Robots) fetch(ctx context.Context, pageUrl *url.URL) (*robotstxt.RobotsData, error) {
+	robotsUrl := &url.URL{
+		Scheme: pageUrl.Scheme,
+		Host:   pageUrl.Host,
+		Path:   "/robots.txt",
+	}
+
+	log := logrus.WithField("url", robotsUrl.String())
+
+	req, err := http.NewRequest("GET", robotsUrl.String(), nil)
+	if err != nil {
+		log.WithError(err).Warn("robots: wrong robots.txt url, everything is allowed")
+		return nil, nil
+	}
+	req.Header.Set("User-Agent", r.Agent)
+	if r.Auth != nil {
+		r.Auth.Apply(req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, robotsTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		log.WithError(err).Warn("robots: can't fetch robots.txt, everything is allowed for a while")
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := robotstxt.FromResponse(res)
+	if err != nil {
+		log.WithError(err).Warn("robots: can't read robots.txt, everything is allowed for a while")
+		return nil, err
+	}
+
+	if res.StatusCode >= 500 {
+		log.WithField("status", res.StatusCode).Warn("robots: server error, everything is disallowed for a while")
+		return data, statusError(res.StatusCode)
+	}
+
+	log.WithField("status", res.StatusCode).Info("robots: loaded")
+	return data, nil
+}
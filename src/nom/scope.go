@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Scope decides which found links are followed by crawl.
+// Rules are options of "global" entities (for all pages) and of page entities (for pages of this type):
+//
+//	global "scope" {
+//	  allow "domain" = "example.com"      // host and its subdomains
+//	  allow "domain" = "cdn.example.net"
+//	  deny "domain" = "ads.example.com"
+//	}
+//	page "item" {
+//	  allow "url" = "^https://example\\.com/items/"  // regular expression
+//	  deny "url" = "[?&]sort="
+//	}
+//
+// Link is followed if it matches at least one "allow" rule of each kind (if there are any) and no "deny" rules.
+type Scope struct {
+	config  *Grammar
+	regexps map[string]*regexp.Regexp // compiled "url" rules
+}
+
+func NewScope(config *Grammar) (*Scope, error) {
+	scope := &Scope{
+		config:  config,
+		regexps: make(map[string]*regexp.Regexp),
+	}
+
+	for _, entity := range config.Entities {
+		for _, option := range entity.Options {
+			if option.Key != "allow" && option.Key != "deny" {
+				continue
+			}
+
+			switch option.Name {
+			case "domain":
+			case "url":
+				re, err := regexp.Compile(option.Value)
+				if err != nil {
+					return nil, fmt.Errorf("%s \"%s\": wrong %s rule: %s", entity.Type, entity.Name, option.Key, err)
+				}
+				scope.regexps[option.Value] = re
+			default:
+				return nil, fmt.Errorf("%s \"%s\": %s rule must be \"domain\" or \"url\", but \"%s\" found", entity.Type, entity.Name, option.Key, option.Name)
+			}
+		}
+	}
+
+	return scope, nil
+}
+
+// Check returns reason why page is out of scope (empty - page may be fetched)
+func (s *Scope) Check(page *Page) string {
+	pageUrl, err := url.Parse(page.Url)
+	if err != nil {
+		return "" // fetcher reports wrong url
+	}
+
+	host := strings.ToLower(pageUrl.Hostname())
+
+	for _, kind := range []string{"domain", "url"} {
+		if kind == "domain" && host == "" {
+			continue // relative url (e.g. start url) belongs to host of referrer
+		}
+
+		rules, allowed := 0, false
+		for _, option := range s.config.Settings(page.Name, "allow") {
+			if option.Name == kind {
+				rules++
+				allowed = allowed || s.matches(option, host, page.Url)
+			}
+		}
+
+		if rules > 0 && !allowed {
+			return fmt.Sprintf("not allowed by %s rules", kind)
+		}
+	}
+
+	for _, option := range s.config.Settings(page.Name, "deny") {
+		if s.matches(option, host, page.Url) {
+			return fmt.Sprintf("denied by %s rule \"%s\"", option.Name, option.Value)
+		}
+	}
+
+	return ""
+}
+
+// matches checks that rule matches host or url of page
+func (s *Scope) matches(option *Option, host string, pageUrl string) bool {
+	switch option.Name {
+	case "domain":
+		domain := strings.ToLower(strings.TrimPrefix(option.Value, "."))
+		return host != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+	case "url":
+		return s.regexps[option.Value].MatchString(pageUrl)
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestScopeCheck(t *testing.T) {
+	config, err := parseConfig(`
+		global "scope" {
+		  allow "domain" = "example.com"
+		  allow "domain" = ".cdn.example.net"
+		  deny "domain" = "ads.example.com"
+		}
+		page "item" {
+		  allow "url" = "^https://example\\.com/items/"
+		  deny "url" = "[?&]sort="
+		}
+		page "other" {
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scope, err := NewScope(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		allowed bool
+	}{
+		{"other", "https://example.com/about", true},
+		{"other", "https://www.EXAMPLE.com/about", true},
+		{"other", "https://img.cdn.example.net/a.png", true},
+		{"other", "https://notexample.com/", false},
+		{"other", "https://example.com.evil.org/", false},
+		{"other", "https://ads.example.com/banner", false},
+		{"other", "/relative/link", true},
+		{"item", "https://example.com/items/1", true},
+		{"item", "https://example.com/items/1?sort=price", false},
+		{"item", "https://example.com/news/1", false},
+		{"item", "https://ads.example.com/items/1", false},
+	}
+
+	for _, test := range tests {
+		reason := scope.Check(&Page{Name: test.name, Url: test.url})
+		if (reason == "") != test.allowed {
+			t.Errorf("%s %s: reason %q, want allowed %v", test.name, test.url, reason, test.allowed)
+		}
+	}
+}
+
+func TestNewScopeErrors(t *testing.T) {
+	tests := []string{
+		`global "scope" { allow "host" = "example.com" }`,
+		`page "item" { deny "url" = "[unclosed" }`,
+	}
+
+	for _, text := range tests {
+		config, err := parseConfig(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewScope(config); err == nil {
+			t.Errorf("wrong rules are accepted: %s", text)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+)
+
+// compiled xpath expressions of routes
+var xpaths sync.Map
+
+// isXPath checks that selector of route is xpath expression rather than css selector
+// (css selectors never start with "/", "./", "../" or "(" and are never ".")
+func isXPath(selector string) bool {
+	if selector == "." {
+		return true // node itself
+	}
+
+	for _, prefix := range []string{"/", "./", "../", "("} {
+		if strings.HasPrefix(selector, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// findSelector returns matches of css selector or xpath expression among descendants of selection
+// (broken xpath expression matches nothing, like broken css selector)
+func findSelector(sel *goquery.Selection, selector string) *goquery.Selection {
+	found, err := selectNodes(sel, selector)
+	if err != nil {
+		logrus.WithField("selector", selector).WithError(err).Warn("parser: wrong xpath expression")
+	}
+	return found
+}
+
+// selectNodes is findSelector which reports wrong xpath expressions.
+// Xpath expressions are evaluated for every node of selection and match its descendants
+// (like css selectors) or node itself (e.g. "."), text nodes are replaced with their parent elements.
+func selectNodes(sel *goquery.Selection, selector string) (*goquery.Selection, error) {
+	if !isXPath(selector) {
+		return sel.Find(selector), nil
+	}
+
+	expr, err := compileXPath(selector)
+	if err != nil {
+		return sel.FindNodes(), err
+	}
+
+	nodes := make([]*html.Node, 0)
+	for _, top := range sel.Nodes {
+		for _, node := range htmlquery.QuerySelectorAll(top, expr) {
+			if node.Type == html.TextNode {
+				node = node.Parent
+			}
+			if node != nil && node.Type == html.ElementNode {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+
+	return sel.FilterNodes(nodes...).AddSelection(sel.FindNodes(nodes...)), nil
+}
+
+func compileXPath(selector string) (*xpath.Expr, error) {
+	if expr, found := xpaths.Load(selector); found {
+		return expr.(*xpath.Expr), nil
+	}
+
+	expr, err := xpath.Compile(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	xpaths.Store(selector, expr)
+	return expr, nil
+}
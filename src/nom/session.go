@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/html/charset"
+)
+
+var ErrLoggedOut = errors.New("page was fetched without login session")
+
+// Session is login through html form described in config by "session" entity:
+//
+//	session "example" {
+//	  url = "https://example.com/login"
+//	  method = "POST"
+//	  field "user" = "${EXAMPLE_USER}"
+//	  field "password" = "${EXAMPLE_PASSWORD}"
+//	  success = "a.logout"
+//	  loggedout = "form#login"
+//	}
+//
+// Session is used for pages of the same host as login url.
+type Session struct {
+	Name      string
+	Url       *url.URL
+	Method    string
+	Fields    url.Values
+	Success   string // selector which must be found on page after login
+	LoggedOut string // selector which means that page was fetched without session
+
+	mutex    sync.Mutex
+	loggedAt time.Time
+}
+
+func NewSession(entity *ConfigEntity) (*Session, error) {
+	session := &Session{
+		Name:   entity.Name,
+		Method: "POST",
+		Fields: make(url.Values),
+	}
+
+	for _, option := range entity.Options {
+		value, err := expandVariables(option.Value)
+		if err != nil {
+			return nil, fmt.Errorf("session \"%s\": %s", entity.Name, err)
+		}
+
+		switch option.Key {
+		case "url":
+			session.Url, err = url.Parse(value)
+			if err != nil {
+				return nil, err
+			}
+		case "method":
+			session.Method = strings.ToUpper(value)
+		case "field":
+			session.Fields.Add(option.Name, value)
+		case "success":
+			session.Success = value
+		case "loggedout":
+			session.LoggedOut = value
+		default:
+			return nil, fmt.Errorf("session \"%s\": unknown option \"%s\"", entity.Name, option.Key)
+		}
+	}
+
+	if session.Url == nil {
+		return nil, fmt.Errorf("session \"%s\": url is required", entity.Name)
+	}
+
+	return session, nil
+}
+
+// expandVariables replaces ${NAME} with environment variables (for secrets)
+func expandVariables(value string) (string, error) {
+	var missed []string
+
+	value = os.Expand(value, func(name string) string {
+		env, found := os.LookupEnv(name)
+		if !found {
+			missed = append(missed, name)
+		}
+		return env
+	})
+
+	if len(missed) > 0 {
+		return "", fmt.Errorf("environment variables %s are not set", strings.Join(missed, ", "))
+	}
+
+	return value, nil
+}
+
+// Login sends login form and checks that response has success selector
+func (s *Session) Login(ctx context.Context, f *FetcherSimple) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.login(ctx, f)
+}
+
+// Relogin logins again if there was no login since specified time (e.g. start of request of logged out page)
+func (s *Session) Relogin(ctx context.Context, f *FetcherSimple, since time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.loggedAt.After(since) {
+		return nil // somebody has already logged in
+	}
+
+	return s.login(ctx, f)
+}
+
+// login is limited by global timeouts of fetcher (login form isn't page of config)
+func (s *Session) login(ctx context.Context, f *FetcherSimple) error {
+	log := logrus.WithField("session", s.Name).WithField("url", s.Url.String())
+	log.Info("session: logging in")
+
+	var req *http.Request
+	var err error
+
+	if s.Method == "GET" {
+		loginUrl := *s.Url
+		loginUrl.RawQuery = s.Fields.Encode()
+		req, err = http.NewRequest(s.Method, loginUrl.String(), nil)
+	} else {
+		req, err = http.NewRequest(s.Method, s.Url.String(), strings.NewReader(s.Fields.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	f.setHeaders(req, "")
+
+	timeouts := f.timeouts(nil)
+	reqCtx, cancel, headerTimer := withTimeouts(ctx, timeouts)
+	defer cancel()
+
+	res, err := f.Client.Do(req.WithContext(reqCtx))
+	if !headersReceived(headerTimer) && ctx.Err() == nil {
+		if err == nil {
+			res.Body.Close()
+		}
+		err = ErrHeaderTimeout
+	}
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("login returns error code %d", res.StatusCode)
+	}
+
+	if s.Success != "" {
+		idle := withIdleTimeout(res.Body, timeouts.Idle, cancel)
+		defer idle.Stop()
+
+		body, err := charset.NewReader(idle, res.Header.Get("Content-Type"))
+		if err != nil {
+			return err
+		}
+
+		doc, err := goquery.NewDocumentFromReader(body)
+		if err != nil {
+			return timeoutError(reqCtx, err)
+		}
+
+		if doc.Find(s.Success).Length() == 0 {
+			return fmt.Errorf("login failed (\"%s\" wasn't found on page)", s.Success)
+		}
+	}
+
+	s.loggedAt = time.Now()
+	log.Info("session: logged in")
+
+	return nil
+}
+
+// Covers checks that page belongs to host of session
+func (s *Session) Covers(pageUrl *url.URL) bool {
+	return pageUrl.Host == s.Url.Host
+}
+
+// IsLoggedOut checks fetched page for "logged out" selector
+func (s *Session) IsLoggedOut(page *Page) bool {
+	if s.LoggedOut == "" || page.IsFile {
+		return false
+	}
+
+	doc, err := newDocument(page)
+	if err != nil {
+		return false
+	}
+
+	return doc.Find(s.LoggedOut).Length() > 0
+}
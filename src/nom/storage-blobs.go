@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/c2h5oh/datasize"
+)
+
+var (
+	ErrFileTooLarge   = errors.New("file is larger than max allowed size")
+	ErrPartialChanged = errors.New("partial download doesn't match requested range")
+	ErrTruncated      = errors.New("length of body doesn't match Content-Length")
+)
+
+// StorageBlobs keeps bodies of downloaded files on disk
+// (pages in cache have only name of blob in Page.Blob instead of Body, so cache dir may be moved).
+// Interrupted downloads are kept as ".part" files with validator (ETag or Last-Modified)
+// and media type of response in ".part.meta" file, so they may be resumed with Range requests.
+type StorageBlobs struct {
+	Base    string
+	MaxSize datasize.ByteSize // 0 - unlimited
+}
+
+// BlobPart describes interrupted download
+type BlobPart struct {
+	Size      int64  // size of downloaded part
+	Validator string // value for If-Range header (empty - download can't be resumed)
+	MediaType string // media type of file (resumed body starts in the middle of file and can't be sniffed)
+}
+
+// Save streams body of file with page key to blob and returns its name, size and sha256.
+// Body is appended to partial download if part.Size isn't zero. Partial download is kept
+// after failure only if part.Validator isn't empty (server supports ranges for this file).
+// Length is expected length of body (-1 - unknown).
+func (b *StorageBlobs) Save(key string, body io.Reader, length int64, part BlobPart) (string, int64, string, error) {
+	offset, validator := part.Size, part.Validator
+
+	fname := b.getPath(key)
+	err := os.MkdirAll(path.Dir(fname), 0755)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	flags := os.O_CREATE | os.O_RDWR | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_RDWR | os.O_APPEND
+	}
+
+	// write to partial file first, so interrupted download doesn't look like complete one
+	file, err := os.OpenFile(fname+".part", flags, 0644)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	// checksum covers already downloaded part too
+	hasher := sha256.New()
+	if read, err := io.Copy(hasher, file); err != nil || read != offset {
+		file.Close()
+		b.Discard(key)
+		return "", 0, "", ErrPartialChanged
+	}
+
+	if validator != "" {
+		err = ioutil.WriteFile(fname+".part.meta", part.meta(), 0644)
+	} else {
+		err = os.Remove(fname + ".part.meta")
+	}
+	if err != nil && !os.IsNotExist(err) {
+		file.Close()
+		return "", 0, "", err
+	}
+
+	reader := body
+	if b.MaxSize > 0 {
+		reader = io.LimitReader(body, int64(b.MaxSize)-offset+1)
+	}
+
+	written, err := io.Copy(io.MultiWriter(file, hasher), reader)
+	file.Close()
+
+	size := offset + written
+	switch {
+	case err != nil:
+	case b.TooLarge(size):
+		err = ErrFileTooLarge
+	case length >= 0 && written != length:
+		err = ErrTruncated
+	}
+
+	if err != nil {
+		if validator == "" || err == ErrFileTooLarge || err == ErrTruncated {
+			b.Discard(key) // only interrupted downloads are resumed
+		}
+		return "", size, "", err
+	}
+
+	os.Remove(fname + ".part.meta")
+	return b.getName(key), size, hex.EncodeToString(hasher.Sum(nil)), os.Rename(fname+".part", fname)
+}
+
+// Path returns path of blob with name returned by Save
+func (b *StorageBlobs) Path(blob string) string {
+	return b.Base + "/" + blob
+}
+
+// Partial returns interrupted download of file with page key
+// (zero size - there is no download to resume)
+func (b *StorageBlobs) Partial(key string) BlobPart {
+	fname := b.getPath(key)
+
+	meta, err := ioutil.ReadFile(fname + ".part.meta")
+	if err != nil {
+		return BlobPart{}
+	}
+
+	part := parseBlobMeta(meta)
+	if part.Validator == "" {
+		return BlobPart{}
+	}
+
+	stat, err := os.Stat(fname + ".part")
+	if err != nil {
+		return BlobPart{}
+	}
+
+	part.Size = stat.Size()
+	return part
+}
+
+// meta returns content of ".part.meta" file: validator and media type on separate lines
+func (p BlobPart) meta() []byte {
+	return []byte(p.Validator + "\n" + p.MediaType)
+}
+
+// parseBlobMeta reads validator and media type of ".part.meta" file (empty validator - wrong file)
+func parseBlobMeta(meta []byte) BlobPart {
+	lines := strings.Split(string(meta), "\n")
+	if len(lines) != 2 {
+		return BlobPart{}
+	}
+	return BlobPart{Validator: lines[0], MediaType: lines[1]}
+}
+
+// Discard removes partial download of file with page key
+func (b *StorageBlobs) Discard(key string) {
+	fname := b.getPath(key)
+
+	os.Remove(fname + ".part")
+	os.Remove(fname + ".part.meta")
+}
+
+// TooLarge checks announced size of file (-1 - unknown size)
+func (b *StorageBlobs) TooLarge(size int64) bool {
+	return b.MaxSize > 0 && size > int64(b.MaxSize)
+}
+
+func (b *StorageBlobs) getPath(key string) string {
+	return b.Path(b.getName(key))
+}
+
+// getName returns name of blob relative to storage dir
+func (b *StorageBlobs) getName(key string) string {
+	hash := md5.Sum([]byte(key))
+	name := hex.EncodeToString(hash[:])
+	return name[0:2] + "/" + name[2:4] + "/" + name + ".blob"
+}
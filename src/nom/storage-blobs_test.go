@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/c2h5oh/datasize"
+)
+
+func TestStorageBlobsSave(t *testing.T) {
+	const key, content = "http://example.com/file", "hello world"
+	sum := sha256.Sum256([]byte(content))
+
+	tests := []struct {
+		name    string
+		maxSize datasize.ByteSize
+		length  int64 // announced length of body
+		err     error
+	}{
+		{"complete", 0, 11, nil},
+		{"unknown length", 0, -1, nil},
+		{"truncated", 0, 20, ErrTruncated},
+		{"longer than announced", 0, 5, ErrTruncated},
+		{"too large", 5, -1, ErrFileTooLarge},
+		{"max size", 11, 11, nil},
+	}
+
+	for _, test := range tests {
+		blobs := &StorageBlobs{Base: t.TempDir(), MaxSize: test.maxSize}
+
+		blob, size, sha, err := blobs.Save(key, strings.NewReader(content), test.length, BlobPart{Validator: `"v1"`})
+		if err != test.err {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.err)
+			continue
+		}
+
+		if part := blobs.Partial(key); part.Size != 0 {
+			t.Errorf("%s: partial download of %d bytes is kept, only interrupted downloads may be resumed", test.name, part.Size)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if size != int64(len(content)) || sha != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: size %d and sha256 %s don't match content", test.name, size, sha)
+		}
+		if filepath.IsAbs(blob) {
+			t.Errorf("%s: blob %s isn't relative to storage dir", test.name, blob)
+		}
+		if data, err := ioutil.ReadFile(blobs.Path(blob)); err != nil || string(data) != content {
+			t.Errorf("%s: blob = %q (%v), want %q", test.name, data, err, content)
+		}
+	}
+}
+
+func TestStorageBlobsPartial(t *testing.T) {
+	const key = "http://example.com/file"
+	blobs := &StorageBlobs{Base: t.TempDir()}
+
+	if part := blobs.Partial(key); part.Size != 0 {
+		t.Fatalf("partial download = %+v for new file", part)
+	}
+
+	body := io.MultiReader(strings.NewReader("hello"), iotest.ErrReader(errors.New("connection reset")))
+	_, _, _, err := blobs.Save(key, body, 11, BlobPart{Validator: `"v1"`, MediaType: "application/pdf"})
+	if err == nil {
+		t.Fatal("interrupted download is saved as complete")
+	}
+
+	want := BlobPart{Size: 5, Validator: `"v1"`, MediaType: "application/pdf"}
+	if part := blobs.Partial(key); part != want {
+		t.Errorf("partial download = %+v, want %+v", part, want)
+	}
+
+	blobs.Discard(key)
+	if part := blobs.Partial(key); part.Size != 0 {
+		t.Errorf("partial download = %+v after discarding", part)
+	}
+}
@@ -13,8 +13,8 @@ type StorageFiles struct {
 	Base string
 }
 
-func (c *StorageFiles) Get(url string) *Page {
-	return c.PageFromFile(c.getPath(url))
+func (c *StorageFiles) Get(key string) *Page {
+	return c.PageFromFile(c.getPath(key))
 }
 
 func (c *StorageFiles) PageFromFile(path string) *Page {
@@ -31,7 +31,7 @@ func (c *StorageFiles) Put(page *Page) {
 		return
 	}
 
-	fname := c.getPath(page.Url)
+	fname := c.getPath(page.Key())
 	err := os.MkdirAll(path.Dir(fname), 0755)
 	if err != nil {
 		return
@@ -44,8 +44,8 @@ func (c *StorageFiles) Put(page *Page) {
 	ioutil.WriteFile(fname, bytes, 0644)
 }
 
-func (c *StorageFiles) getPath(url string) string {
-	hash := md5.Sum([]byte(url))
+func (c *StorageFiles) getPath(key string) string {
+	hash := md5.Sum([]byte(key))
 	name := hex.EncodeToString(hash[:])
 	return c.Base + "/" + name[0:2] + "/" + name[2:4] + "/" + name + ".pac"
 }
@@ -54,7 +54,10 @@ func (c *StorageFiles) Iterate() <-chan *Page {
 	ch := make(chan *Page)
 	go func() {
 		filepath.Walk(c.Base, func(path string, f os.FileInfo, err error) error {
-			if !f.IsDir() {
+			if err != nil {
+				return err // e.g. there is no cache dir yet
+			}
+			if !f.IsDir() && filepath.Ext(path) == ".pac" { // skip blobs and temporary files
 				ch <- c.PageFromFile(path)
 			}
 			return err
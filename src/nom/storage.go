@@ -1,7 +1,7 @@
 package main
 
 type Storage interface {
-	Get(url string) *Page
+	Get(key string) *Page // get page by its Page.Key()
 	Put(page *Page)
 	Iterate() <-chan *Page // iterate over all pages in storage
 }
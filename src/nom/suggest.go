@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Suggester proposes selectors for nodes with example values (first step of writing config for new site)
+type Suggester struct {
+	page *Page
+	doc  *goquery.Document
+
+	identifier *regexp.Regexp // ids and classes usable in selectors without escaping
+}
+
+// Candidate is proposed selector
+type Candidate struct {
+	Selector  string
+	Stability int // 3 - id, 2 - classes, 1 - tags, 0 - position (nth-child)
+	Matches   int // count of matched nodes
+	Samples   []string
+}
+
+func NewSuggester(page *Page) (*Suggester, error) {
+	doc, err := newDocument(page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Suggester{
+		page: page,
+		doc:  doc,
+
+		identifier: regexp.MustCompile(`^-?[_a-zA-Z][_a-zA-Z0-9-]*$`),
+	}, nil
+}
+
+// Suggest prints ranked selectors for every example and skeleton config with all examples as one repeated block
+func (s *Suggester) Suggest(w io.Writer, examples []string) error {
+	hits := make([]*html.Node, 0, len(examples))
+	seen := make(map[*html.Node]bool)
+
+	for _, example := range examples {
+		node := s.find(example)
+		if node == nil {
+			return fmt.Errorf("can't find \"%s\" on page", example)
+		}
+		if !seen[node] {
+			hits = append(hits, node) // several examples may be found in the same node
+			seen[node] = true
+		}
+
+		fmt.Fprintf(w, "%q:\n", example)
+		for _, candidate := range s.rank(s.doc.Selection, node) {
+			fmt.Fprintf(w, "  [%d] %-40s %d matches: %s\n", candidate.Stability, candidate.Selector, candidate.Matches, strings.Join(candidate.Samples, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+
+	name := s.page.Name
+	if name == "" {
+		name = "page"
+	}
+	page := &ConfigEntity{Type: "page", Name: name}
+
+	if len(hits) == 1 {
+		selector, err := s.best(s.doc.Selection, hits[0], false)
+		if err != nil {
+			return err
+		}
+
+		page.Routes = append(page.Routes, &Route{
+			Selector: selector,
+			Type:     "block",
+			Name:     s.fieldName(hits[0], 0, nil),
+		})
+
+		fmt.Fprintf(w, "skeleton:\n%s\n", page)
+		return nil
+	}
+
+	// all examples are expected to be parts of single repeated item (like name and price of product)
+	item := commonAncestor(hits)
+	block := &ConfigEntity{Type: "block", Name: "item"}
+
+	selector, err := s.best(s.doc.Selection, item, true)
+	if err != nil {
+		return err
+	}
+
+	page.Routes = append(page.Routes, &Route{
+		Selector: selector,
+		Type:     "block",
+		Name:     block.Name,
+	})
+
+	names := make(map[string]bool)
+	for i, hit := range hits {
+		selector := "." // example is text of item itself
+		if hit != item {
+			selector, err = s.best(goquery.NewDocumentFromNode(item).Selection, hit, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		block.Routes = append(block.Routes, &Route{
+			Selector: selector,
+			Type:     "block",
+			Name:     s.fieldName(hit, i, names),
+		})
+	}
+
+	fmt.Fprintf(w, "skeleton:\n%s\n%s\n", page, block)
+	return nil
+}
+
+// find returns the deepest element which contains example in its text
+func (s *Suggester) find(example string) *html.Node {
+	example = normalizeText(example)
+	contains := func(i int, sel *goquery.Selection) bool {
+		return strings.Contains(normalizeText(sel.Text()), example)
+	}
+
+	sel := s.doc.Find("body").FilterFunction(contains)
+	if sel.Length() == 0 {
+		return nil
+	}
+
+	// go down through the first child with example until there is no such child
+	for child := sel.Children().FilterFunction(contains).First(); child.Length() > 0; child = sel.Children().FilterFunction(contains).First() {
+		sel = child
+	}
+
+	return sel.Nodes[0]
+}
+
+// rank returns all candidate selectors for node inside scope sorted by stability
+func (s *Suggester) rank(scope *goquery.Selection, node *html.Node) []*Candidate {
+	candidates := make([]*Candidate, 0)
+	seen := make(map[string]bool)
+
+	for _, candidate := range s.candidates(node) {
+		if seen[candidate.Selector] {
+			continue
+		}
+		seen[candidate.Selector] = true
+
+		sel := scope.Find(candidate.Selector)
+		if sel.IndexOfNode(node) < 0 {
+			continue // doesn't match node itself (e.g. id is not unique)
+		}
+
+		candidate.Matches = sel.Length()
+		sel.EachWithBreak(func(i int, sel *goquery.Selection) bool {
+			candidate.Samples = append(candidate.Samples, fmt.Sprintf("%q", truncateText(normalizeText(sel.Text()), 30)))
+			return i < 2
+		})
+
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Stability != candidates[j].Stability {
+			return candidates[i].Stability > candidates[j].Stability
+		}
+		return candidates[i].Matches > candidates[j].Matches // more matches - more similar repeated items
+	})
+
+	return candidates
+}
+
+// best returns the most stable selector for node inside scope:
+// matching repeated items (if repeated is true) or only node itself
+func (s *Suggester) best(scope *goquery.Selection, node *html.Node, repeated bool) (string, error) {
+	candidates := s.rank(scope, node)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("can't find selector for <%s> inside <%s>", node.Data, goquery.NodeName(scope))
+	}
+
+	for _, candidate := range candidates {
+		if repeated == (candidate.Matches > 1) {
+			return candidate.Selector, nil
+		}
+	}
+
+	return candidates[0].Selector, nil
+}
+
+func (s *Suggester) candidates(node *html.Node) []*Candidate {
+	candidates := make([]*Candidate, 0)
+
+	own := s.simpleSelectors(node)
+	candidates = append(candidates, own...)
+
+	// qualify own selectors with parent's ones
+	if node.Parent != nil && node.Parent.Type == html.ElementNode {
+		for _, parent := range s.simpleSelectors(node.Parent) {
+			if parent.Stability < 2 {
+				continue
+			}
+
+			for _, candidate := range own {
+				candidates = append(candidates, &Candidate{
+					Selector:  parent.Selector + " > " + candidate.Selector,
+					Stability: candidate.Stability, // parent is at least as stable as classes (checked above)
+				})
+			}
+		}
+	}
+
+	// fallback to position in document
+	candidates = append(candidates, &Candidate{
+		Selector:  nodePath(node),
+		Stability: 0,
+	})
+
+	return candidates
+}
+
+// simpleSelectors returns selectors for node itself (by id, classes or tag)
+func (s *Suggester) simpleSelectors(node *html.Node) []*Candidate {
+	candidates := make([]*Candidate, 0)
+	classes := make([]string, 0)
+
+	for _, attr := range node.Attr {
+		switch {
+		case attr.Key == "id" && s.identifier.MatchString(attr.Val):
+			candidates = append(candidates, &Candidate{
+				Selector:  "#" + attr.Val,
+				Stability: stability(attr.Val, 3),
+			})
+
+		case attr.Key == "class":
+			for _, class := range strings.Fields(attr.Val) {
+				if s.identifier.MatchString(class) {
+					classes = append(classes, class)
+				}
+			}
+		}
+	}
+
+	for _, class := range classes {
+		candidates = append(candidates, &Candidate{
+			Selector:  node.Data + "." + class,
+			Stability: stability(class, 2),
+		})
+	}
+
+	if len(classes) > 1 {
+		candidates = append(candidates, &Candidate{
+			Selector:  node.Data + "." + strings.Join(classes, "."),
+			Stability: stability(strings.Join(classes, ""), 2),
+		})
+	}
+
+	candidates = append(candidates, &Candidate{
+		Selector:  node.Data,
+		Stability: 1,
+	})
+
+	return candidates
+}
+
+// fieldName names route after first class of node (if possible)
+func (s *Suggester) fieldName(node *html.Node, i int, used map[string]bool) string {
+	name := fmt.Sprintf("field%d", i+1)
+
+	for _, attr := range node.Attr {
+		if fields := strings.Fields(attr.Val); attr.Key == "class" && len(fields) > 0 && !used[fields[0]] {
+			name = fields[0]
+			break
+		}
+	}
+
+	if used != nil {
+		used[name] = true
+	}
+
+	return name
+}
+
+// stability lowers stability of ids and classes which look generated (e.g. "css-1f2e3d")
+func stability(name string, stability int) int {
+	if strings.IndexAny(name, "0123456789") >= 0 {
+		return stability - 1
+	}
+	return stability
+}
+
+func commonAncestor(nodes []*html.Node) *html.Node {
+	ancestor := nodes[0]
+
+	for _, node := range nodes[1:] {
+		for !isAncestor(ancestor, node) {
+			ancestor = ancestor.Parent
+		}
+	}
+
+	return ancestor
+}
+
+// isAncestor checks that node is ancestor or the same node
+func isAncestor(ancestor *html.Node, node *html.Node) bool {
+	for ; node != nil; node = node.Parent {
+		if node == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func truncateText(text string, length int) string {
+	if runes := []rune(text); len(runes) > length {
+		return string(runes[:length-3]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrHeaderTimeout = errors.New("timeout awaiting response headers")
+var ErrIdleTimeout = errors.New("timeout awaiting response body")
+
+// Timeouts limits stages of request (zero - no limit). Limits may be overridden
+// by options of "global" and page entities:
+//
+//	page "video" {
+//	  timeout "connect" = "5s"
+//	  timeout "header" = "1m"
+//	  timeout "idle" = "2m"
+//	  timeout "total" = "2h"
+//	}
+type Timeouts struct {
+	Connect time.Duration // establishing of connection
+	Header  time.Duration // waiting for response headers (since start of request)
+	Idle    time.Duration // waiting for next part of body (stalled transfer)
+	Total   time.Duration // whole request including transfer of body
+}
+
+// timeouts returns timeouts for page (page may be nil, e.g. for robots.txt)
+func (f *FetcherSimple) timeouts(page *Page) Timeouts {
+	timeouts := f.Timeouts
+	if f.Config == nil || page == nil {
+		return timeouts
+	}
+
+	for name, timeout := range map[string]*time.Duration{"connect": &timeouts.Connect, "header": &timeouts.Header, "idle": &timeouts.Idle, "total": &timeouts.Total} {
+		value, found := f.Config.Setting(page.Name, "timeout", name)
+		if !found {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			logrus.WithField("name", page.Name).WithField("timeout", name).WithField("value", value).Warn("fetcher: wrong timeout")
+			continue
+		}
+		*timeout = duration
+	}
+
+	return timeouts
+}
+
+// dial establishes connection with connect timeout of page from context
+func (f *FetcherSimple) dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	page, _ := ctx.Value(pageKey{}).(*Page)
+
+	dialer := &net.Dialer{
+		Timeout:   f.timeouts(page).Connect,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// withTimeouts returns context of request which is canceled after total timeout or after
+// header timeout (if headers weren't received, see headersReceived)
+func withTimeouts(ctx context.Context, timeouts Timeouts) (context.Context, context.CancelFunc, *time.Timer) {
+	var cancel context.CancelFunc
+	if timeouts.Total > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeouts.Total)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	var timer *time.Timer
+	if timeouts.Header > 0 {
+		timer = time.AfterFunc(timeouts.Header, cancel)
+	}
+
+	return ctx, cancel, timer
+}
+
+// timeoutError replaces error of transfer interrupted by total timeout
+// (reading of closed connection returns confusing errors)
+func timeoutError(reqCtx context.Context, err error) error {
+	if reqCtx.Err() == context.DeadlineExceeded {
+		return &FetchError{Temporary: true, Err: context.DeadlineExceeded}
+	}
+	return err
+}
+
+// headersReceived stops header timer and checks that it hasn't fired
+func headersReceived(timer *time.Timer) bool {
+	return timer == nil || timer.Stop()
+}
+
+// idleReader cancels request when body isn't received during idle timeout
+type idleReader struct {
+	reader  io.Reader
+	timeout time.Duration
+	timer   *time.Timer // nil - no idle timeout
+}
+
+// withIdleTimeout limits reading of body with idle timeout (cancel stops the request)
+func withIdleTimeout(body io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleReader {
+	reader := &idleReader{reader: body, timeout: timeout}
+	if timeout > 0 {
+		reader.timer = time.AfterFunc(timeout, cancel)
+	}
+	return reader
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if r.timer == nil {
+		return n, err
+	}
+
+	if !r.timer.Stop() {
+		return n, ErrIdleTimeout // request is canceled, error of reading is confusing
+	}
+
+	if err != nil {
+		r.timer = nil // body is read (or failed), next reads aren't limited
+	} else {
+		r.timer.Reset(r.timeout)
+	}
+
+	return n, err
+}
+
+// Stop stops idle timer (when body isn't read till the end)
+func (r *idleReader) Stop() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
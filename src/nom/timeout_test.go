@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchIdleTimeout(t *testing.T) {
+	stall := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("<html>"))
+		w.(http.Flusher).Flush()
+
+		if r.URL.Path == "/stalled" {
+			<-stall // headers are sent, but body never ends
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write(make([]byte, 94))
+	}))
+	defer server.Close()
+	defer close(stall) // before closing of server, which waits for handlers
+
+	tests := []struct {
+		path string
+		err  error // nil - page is delivered
+	}{
+		{"/stalled", ErrIdleTimeout},
+		{"/slow", nil}, // pauses shorter than timeout are fine
+	}
+
+	for _, test := range tests {
+		f, err := NewFetcherSimple(server.URL, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Robots = nil
+		f.Timeouts = Timeouts{Idle: 200 * time.Millisecond}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		f.Start(ctx)
+		go f.Queue(ctx, &Page{Url: test.path})
+
+		select {
+		case <-f.Delivery():
+			if test.err != nil {
+				t.Errorf("%s: page is delivered, want error %v", test.path, test.err)
+			}
+		case page := <-f.Errors():
+			fetchErr, ok := page.err.(*FetchError)
+			if !ok || !fetchErr.Temporary || !errors.Is(fetchErr, test.err) {
+				t.Errorf("%s: error = %v, want temporary %v", test.path, page.err, test.err)
+			}
+		case <-ctx.Done():
+			t.Errorf("%s: fetching is stalled", test.path)
+		}
+
+		cancel()
+		f.Wait()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Tryout parses pages from storage with config entities or ad-hoc selectors
+// without touching network or any queues (handy for tuning selectors)
+type Tryout struct {
+	storage Storage
+	parser  *Parser
+}
+
+func NewTryout(config *Grammar, storage Storage) (*Tryout, error) {
+	parser := NewParser(config, nil) // parser without logist never fetches anything
+
+	var err error
+	parser.Scope, err = NewScope(config) // links out of scope are shown as skipped (like in crawl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tryout{
+		storage: storage,
+		parser:  parser,
+	}, nil
+}
+
+// Try parses page found by key (url or page name) and prints parsed tree and child pages.
+// If route has selector it's used instead of config entity.
+func (t *Tryout) Try(w io.Writer, key string, entity string, route *Route) error {
+	page, config, doc, err := t.prepare(key, entity, route)
+	if err != nil {
+		return err
+	}
+
+	tree, childPages := t.parser.parseRecursive(page, doc.Selection, config)
+
+	fmt.Fprintf(w, "page \"%s\" (%s) parsed with %s \"%s\"\n\n", page.Name, page.Url, config.Type, config.Name)
+	printBlock(w, tree, "")
+
+	fmt.Fprintf(w, "\nchild pages (%d):\n", len(childPages))
+	for _, childPage := range childPages {
+		kind := "page"
+		if childPage.IsFile {
+			kind = "file"
+		}
+		if childPage.Method != "" {
+			kind += " " + childPage.Method
+		}
+		fmt.Fprintf(w, "  %s \"%s\" %s %s\n", kind, childPage.Name, childPage.Url, childPage.Payload)
+
+		if reason := t.parser.Scope.Check(childPage); reason != "" {
+			fmt.Fprintf(w, "    skipped (out of scope): %s\n", reason) // crawl doesn't follow it
+		}
+	}
+
+	return nil
+}
+
+// prepare loads page from storage, finds config for parsing and builds html document
+func (t *Tryout) prepare(key string, entity string, route *Route) (*Page, *ConfigEntity, *goquery.Document, error) {
+	page, err := findPage(t.storage, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	config, err := t.config(page, entity, route)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	doc, err := newDocument(page)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return page, config, doc, nil
+}
+
+func (t *Tryout) config(page *Page, entity string, route *Route) (*ConfigEntity, error) {
+	if route != nil && route.Selector != "" {
+		return &ConfigEntity{
+			Type:   "page",
+			Name:   "ad-hoc",
+			Routes: []*Route{route},
+		}, nil
+	}
+
+	if entity == "" {
+		entity = page.Name
+	}
+
+	if config, found := t.parser.pagesConfigs[entity]; found {
+		return config, nil
+	}
+
+	if config, found := t.parser.blocksConfigs[entity]; found {
+		return config, nil
+	}
+
+	return nil, fmt.Errorf("unknown page or block \"%s\"", entity)
+}
+
+// findPage loads page from storage by its url or (if nothing found) by its name in config
+func findPage(storage Storage, key string) (*Page, error) {
+	if page := storage.Get(key); page != nil {
+		return page, nil
+	}
+
+	var found *Page
+	for page := range storage.Iterate() {
+		if found == nil && page != nil && page.Name == key && !page.IsFile {
+			found = page // NOTE: don't break, channel must be drained
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("can't find page \"%s\" in storage", key)
+	}
+
+	return found, nil
+}
+
+func printBlock(w io.Writer, block *Block, indent string) {
+	names := make([]string, 0, len(block.Fields))
+	for name := range block.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := block.Fields[name]
+		fmt.Fprintf(w, "%s%s (%d):\n", indent, name, len(values))
+
+		for i, value := range values {
+			switch value := value.(type) {
+			case *Block:
+				fmt.Fprintf(w, "%s  #%d\n", indent, i)
+				printBlock(w, value, indent+strings.Repeat(" ", 4))
+			default:
+				fmt.Fprintf(w, "%s  %q\n", indent, value)
+			}
+		}
+	}
+}
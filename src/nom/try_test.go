@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTryScope(t *testing.T) {
+	config, err := parseConfig(`
+		global "scope" {
+		  allow "domain" = "example.com"
+		}
+		page "list" {
+		  "a" -> page "item"
+		}
+		page "item" {
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := &Page{
+		Name: "list",
+		Url:  "http://example.com/list",
+		Body: []byte(`<a href="/items/1">item</a><a href="http://other.com/items/2">item</a>`),
+	}
+	storage := &memoryStorage{pages: map[string]*Page{page.Key(): page}}
+
+	tryout, err := NewTryout(config, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := &strings.Builder{}
+	if err := tryout.Try(output, page.Key(), "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `child pages (2):
+  page "item" http://example.com/items/1 
+  page "item" http://other.com/items/2 
+    skipped (out of scope): not allowed by domain rules
+`
+	if !strings.HasSuffix(output.String(), want) {
+		t.Errorf("output:\n%s\nwant child pages:\n%s", output, want)
+	}
+}